@@ -2,61 +2,372 @@ package apiserver
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"net/http"
+	"sync/atomic"
 	"time"
 
+	"github.com/geisonsn/go-and-compose/logging"
 	"github.com/geisonsn/go-and-compose/storage"
+	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
-var defaultStopTimeout = time.Second * 30
+// Options configures the API server.
+type Options struct {
+	// ShutdownTimeout bounds how long in-flight requests and shutdown hooks
+	// get to finish once the server stops.
+	ShutdownTimeout time.Duration
+	// DrainDelay is how long the server keeps serving, with /readyz failing,
+	// after being told to stop so load balancers can take it out of rotation
+	// first.
+	DrainDelay time.Duration
+
+	// TLSCertFile and TLSKeyFile enable HTTPS, with HTTP/2, when set. They
+	// are reloaded on SIGHUP.
+	TLSCertFile string
+	TLSKeyFile  string
+	// TLSClientCAFile, when set, requires clients to present a certificate
+	// signed by one of the CAs in the bundle.
+	TLSClientCAFile string
+	// H2C serves HTTP/2 without TLS, for internal traffic.
+	H2C bool
+
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+	// MaxBodyBytes is the largest request body accepted, larger ones get a
+	// 413.
+	MaxBodyBytes int64
+	// HandlerTimeout bounds the context of every request, canceling storage
+	// calls that outlive it. Zero disables it.
+	HandlerTimeout time.Duration
+
+	// AuthEnabled, the default, requires an API key or a bearer token on the
+	// item routes. Without it every request acts as the anonymous writer.
+	AuthEnabled bool
+	// JWTHMACSecret verifies HS256/384/512 bearer tokens.
+	JWTHMACSecret string
+	// JWKSFile is a local JWKS document with the RSA keys verifying RS256
+	// bearer tokens.
+	JWKSFile string
+	// JWTIssuer and JWTAudience, when set, must match the iss and aud claims.
+	JWTIssuer   string
+	JWTAudience string
+
+	// RateLimit applies to every item route, per caller. RouteRateLimits
+	// overrides it for the routes they name, as "METHOD /path/template".
+	RateLimit       RateLimit
+	RouteRateLimits map[string]RateLimit
+	// IPRateLimit applies to every item route, per client address, before
+	// authentication, so requests with bad credentials are limited too.
+	IPRateLimit RateLimit
+	// SharedRateLimits counts requests in the database instead of in
+	// process, so the limits hold across replicas.
+	SharedRateLimits bool
+
+	// ValidateRequests, the default, rejects item requests with parameters or
+	// bodies that don't match the OpenAPI document. ValidateResponses checks
+	// the responses, turning the ones that don't match into errors; it is
+	// meant for development.
+	ValidateRequests  bool
+	ValidateResponses bool
+
+	// MaxBatchSize is the most items POST /items/batch creates at once.
+	MaxBatchSize int
+}
+
+func DefaultOptions() Options {
+	return Options{
+		ShutdownTimeout:   time.Second * 30,
+		DrainDelay:        time.Second * 5,
+		ReadTimeout:       time.Second * 15,
+		ReadHeaderTimeout: time.Second * 5,
+		WriteTimeout:      time.Second * 30,
+		IdleTimeout:       time.Minute * 2,
+		MaxHeaderBytes:    1 << 20,
+		MaxBodyBytes:      1 << 20,
+		HandlerTimeout:    time.Second * 20,
+		AuthEnabled:       true,
+		ValidateRequests:  true,
+		MaxBatchSize:      1000,
+	}
+}
+
+// Validate checks the options are consistent before any listener is opened.
+func (o Options) Validate() error {
+	if o.ShutdownTimeout <= 0 {
+		return errors.New("shutdown timeout must be positive")
+	}
+	if o.DrainDelay < 0 {
+		return errors.New("drain delay cannot be negative")
+	}
+	if o.ReadTimeout < 0 || o.ReadHeaderTimeout < 0 || o.WriteTimeout < 0 || o.IdleTimeout < 0 || o.HandlerTimeout < 0 {
+		return errors.New("server timeouts cannot be negative")
+	}
+	if o.MaxHeaderBytes < 0 {
+		return errors.New("max header bytes cannot be negative")
+	}
+	if o.MaxBodyBytes <= 0 {
+		return errors.New("max body bytes must be positive")
+	}
+	if o.MaxBatchSize <= 0 {
+		return errors.New("max batch size must be positive")
+	}
+
+	if err := validateRateLimits(o); err != nil {
+		return err
+	}
+
+	return validateTLSOptions(o)
+}
+
+// ItemStore is the storage backend used by the API server. storage.Storage
+// and storage.MemoryStorage both implement it.
+type ItemStore interface {
+	CreateItem(ctx context.Context, i storage.CreateItemRequest) (*storage.Item, error)
+	CreateItems(ctx context.Context, reqs []storage.CreateItemRequest) ([]*storage.Item, error)
+	GetItem(ctx context.Context, id string) (*storage.Item, error)
+	UpdateItem(ctx context.Context, id string, i storage.UpdateItemRequest) (*storage.Item, error)
+	DeleteItem(ctx context.Context, id string) error
+	ListItems(ctx context.Context, q storage.ListItemsQuery) (*storage.ItemPage, error)
+
+	Ping(ctx context.Context) error
+	Stats() sql.DBStats
+	Close() error
+}
+
+// migrationChecker is implemented by stores with a schema that readiness
+// checks should verify is up to date.
+type migrationChecker interface {
+	PendingMigrations(ctx context.Context) ([]storage.Migration, error)
+}
+
+// ShutdownHook releases a resource when the server stops. ctx expires with
+// the shutdown timeout.
+type ShutdownHook func(ctx context.Context) error
+
+type namedShutdownHook struct {
+	name string
+	fn   ShutdownHook
+}
 
 type APIServer struct {
-	addr    string
-	storage *storage.Storage
+	addr     string
+	opts     Options
+	storage  ItemStore
+	metrics  *metrics
+	auth     *authenticator
+	limiter  *rateLimiter
+	openAPI  *openapi3.T
+	contract *contract
+	certs    *certReloader
+	hooks    []namedShutdownHook
+	draining int32
 }
 
-func NewAPIServer(addr string, storage *storage.Storage) (*APIServer, error) {
+func NewAPIServer(addr string, store ItemStore, opts Options) (*APIServer, error) {
 	if addr == "" {
 		return nil, errors.New("addr cannot be blank")
 	}
 
-	return &APIServer{
-		addr:    addr,
-		storage: storage,
-	}, nil
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	auth, err := newAuthenticator(store, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	limiter, err := newRateLimiter(store, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := OpenAPI()
+	if err != nil {
+		return nil, err
+	}
+
+	contract, err := newContract(doc, opts.ValidateRequests, opts.ValidateResponses)
+	if err != nil {
+		return nil, err
+	}
+
+	// Certificates are loaded here rather than in Start so that a bad
+	// certificate fails before the caller hands the store over to the server.
+	var certs *certReloader
+	if opts.TLSCertFile != "" {
+		certs, err = newCertReloader(opts.TLSCertFile, opts.TLSKeyFile, opts.TLSClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s := &APIServer{
+		addr:     addr,
+		opts:     opts,
+		storage:  store,
+		metrics:  newMetrics(store),
+		auth:     auth,
+		limiter:  limiter,
+		openAPI:  doc,
+		contract: contract,
+		certs:    certs,
+	}
+
+	if err := checkRoutesDocumented(s.routes(), doc); err != nil {
+		return nil, err
+	}
+
+	return s, nil
 }
 
+// OnShutdown registers fn to run once the HTTP server has stopped accepting
+// requests. Hooks run in the order they were registered, and the store is
+// always closed after all of them.
+func (s *APIServer) OnShutdown(name string, fn ShutdownHook) {
+	s.hooks = append(s.hooks, namedShutdownHook{name: name, fn: fn})
+}
+
+// Start serves until stop is closed or the listener fails, then shuts down:
+// it drains, waits for in-flight requests, runs the shutdown hooks and closes
+// the store. A listen failure is returned once the shutdown is complete.
 func (s *APIServer) Start(stop <-chan struct{}) error {
 	srv := &http.Server{
-		Addr:    s.addr,
-		Handler: s.router(),
+		Addr:              s.addr,
+		Handler:           s.router(),
+		ReadTimeout:       s.opts.ReadTimeout,
+		ReadHeaderTimeout: s.opts.ReadHeaderTimeout,
+		WriteTimeout:      s.opts.WriteTimeout,
+		IdleTimeout:       s.opts.IdleTimeout,
+		MaxHeaderBytes:    s.opts.MaxHeaderBytes,
+	}
+
+	listen := srv.ListenAndServe
+	if s.certs != nil {
+		stopWatching := make(chan struct{})
+		defer close(stopWatching)
+		go s.certs.watch(stopWatching)
+
+		srv.TLSConfig = s.certs.tlsConfig()
+		listen = func() error { return srv.ListenAndServeTLS("", "") }
+	} else if s.opts.H2C {
+		srv.Handler = h2c.NewHandler(srv.Handler, &http2.Server{})
+	}
+
+	if !s.opts.AuthEnabled {
+		logrus.Warn("AUTHENTICATION IS DISABLED: anyone who can reach the server can create, change and delete the anonymous items")
 	}
 
+	listenErr := make(chan error, 1)
 	go func() {
-		logrus.WithField("addr", srv.Addr).Info("starting server")
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			logrus.Fatal("listen %s\n", err)
+		logrus.WithFields(logrus.Fields{
+			"addr": srv.Addr,
+			"tls":  srv.TLSConfig != nil,
+			"h2c":  s.opts.H2C,
+		}).Info("starting server")
+		if err := listen(); err != nil && err != http.ErrServerClosed {
+			listenErr <- fmt.Errorf("could not listen on %s: %w", srv.Addr, err)
 		}
+		close(listenErr)
 	}()
 
-	<-stop
-	ctx, cancel := context.WithTimeout(context.Background(), defaultStopTimeout)
+	var serveErr error
+	select {
+	case serveErr = <-listenErr:
+	case <-stop:
+		atomic.StoreInt32(&s.draining, 1)
+		logrus.WithField("delay", s.opts.DrainDelay).Info("draining server")
+		select {
+		case <-time.After(s.opts.DrainDelay):
+		case serveErr = <-listenErr:
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.opts.ShutdownTimeout)
 	defer cancel()
 
-	logrus.WithField("timeout", defaultStopTimeout).Info("stopping server")
-	return srv.Shutdown(ctx)
+	logrus.WithField("timeout", s.opts.ShutdownTimeout).Info("stopping server")
+	errs := []error{serveErr}
+	if err := srv.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("could not stop server: %w", err))
+	}
+
+	hooks := append(s.hooks, namedShutdownHook{name: "storage", fn: func(context.Context) error {
+		return s.storage.Close()
+	}})
+	for _, h := range hooks {
+		logrus.WithField("hook", h.name).Debug("running shutdown hook")
+		if err := h.fn(ctx); err != nil {
+			logrus.WithError(err).WithField("hook", h.name).Error("shutdown hook failed")
+			errs = append(errs, fmt.Errorf("shutdown hook %s: %w", h.name, err))
+		}
+	}
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Handler returns the handler serving the API, to mount it in another server
+// or an httptest.Server.
+func (s *APIServer) Handler() http.Handler {
+	return s.router()
 }
 
 func (s *APIServer) router() http.Handler {
+	return logRequests(s.metrics.instrument(s.routes()))
+}
+
+func (s *APIServer) routes() *mux.Router {
 	router := mux.NewRouter()
+	router.NotFoundHandler = Endpoint{handler: routeNotFound}
+	router.MethodNotAllowedHandler = Endpoint{handler: methodNotAllowed}
+	router.Use(limitBodies(s.opts.MaxBodyBytes))
+	if s.opts.HandlerTimeout > 0 {
+		router.Use(timeoutHandlers(s.opts.HandlerTimeout))
+	}
 
 	router.HandleFunc("/", s.defaultRoute)
-	router.Methods("POST").Path("/items").Handler(Endpoint{s.createItem})
-	router.Methods("GET").Path("/items").Handler(Endpoint{s.listItems})
+	router.Methods("GET").Path("/healthz").Handler(Endpoint{handler: s.healthz})
+	router.Methods("GET").Path("/readyz").Handler(Endpoint{handler: s.readyz})
+	router.Methods("GET").Path("/metrics").Handler(s.metrics.handler())
+	router.Methods("GET").Path("/openapi.json").Handler(Endpoint{handler: s.openAPIDocument})
+	router.Methods("GET").Path("/docs").Handler(Endpoint{handler: s.docs})
+
+	items := router.PathPrefix("/items").Subrouter()
+	items.NotFoundHandler = router.NotFoundHandler
+	items.MethodNotAllowedHandler = router.MethodNotAllowedHandler
+	items.Use(s.limiter.addressMiddleware)
+	if s.opts.AuthEnabled {
+		items.Use(s.auth.middleware)
+	} else {
+		items.Use(allowAnonymous)
+	}
+	items.Use(s.limiter.middleware)
+	if s.opts.ValidateRequests || s.opts.ValidateResponses {
+		items.Use(s.contract.middleware)
+	}
+	items.Methods("POST").Path("").Handler(Endpoint{s.createItem, storage.RoleWriter})
+	items.Methods("GET").Path("").Handler(Endpoint{s.listItems, storage.RoleReader})
+	items.Methods("POST").Path("/batch").Handler(Endpoint{s.createItems, storage.RoleWriter})
+	items.Methods("GET").Path("/{id}").Handler(Endpoint{s.getItem, storage.RoleReader})
+	items.Methods("PUT").Path("/{id}").Handler(Endpoint{s.replaceItem, storage.RoleWriter})
+	items.Methods("PATCH").Path("/{id}").Handler(Endpoint{s.updateItem, storage.RoleWriter})
+	items.Methods("DELETE").Path("/{id}").Handler(Endpoint{s.deleteItem, storage.RoleWriter})
 	return router
 }
 
@@ -65,42 +376,44 @@ func (s *APIServer) defaultRoute(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("Hello World"))
 }
 
-func (s *APIServer) createItem(w http.ResponseWriter, req *http.Request) error {
-	item, err := s.storage.CreateItem(req.Context(), storage.CreateItemRequest{
-		Name: req.PostFormValue("name"),
-	})
+// Endpoint adapts an EndpointFunc to http.Handler, rendering the errors it
+// returns. When role is set, the request must have been authenticated as a
+// principal with that role, or a higher one, to reach the handler.
+type Endpoint struct {
+	handler EndpointFunc
+	role    storage.Role
+}
 
-	if err != nil {
-		return err
-	}
+type EndpointFunc func(w http.ResponseWriter, req *http.Request) error
 
-	w.WriteHeader(http.StatusCreated)
-	_, err = w.Write([]byte(fmt.Sprintf("New Item ID: %s", item.ID)))
-	return err
-}
+func (e Endpoint) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	err := e.authorize(req)
+	if err == nil {
+		err = e.handler(w, req)
+	}
 
-func (s *APIServer) listItems(w http.ResponseWriter, req *http.Request) error {
-	items, err := s.storage.ListItems(req.Context())
 	if err != nil {
-		return err
-	}
+		apiErr := toAPIError(err)
+		if apiErr.Status >= http.StatusInternalServerError {
+			logging.FromContext(req.Context()).WithError(err).Error("could not process request")
+		}
 
-	for _, item := range items {
-		w.Write([]byte(fmt.Sprintf("%s - %s\n", item.ID, item.Name)))
+		writeJSON(w, apiErr.Status, errorEnvelope{Error: apiErr})
 	}
-	return nil
-}
-
-type Endpoint struct {
-	handler EndpointFunc
 }
 
-type EndpointFunc func(w http.ResponseWriter, req *http.Request) error
+func (e Endpoint) authorize(req *http.Request) error {
+	if e.role == "" {
+		return nil
+	}
 
-func (e Endpoint) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	if err := e.handler(w, req); err != nil {
-		logrus.WithError(err).Error("could not process request")
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("internal server error"))
+	p, ok := PrincipalFromContext(req.Context())
+	if !ok {
+		return unauthorized(errors.New("no authenticated principal"))
 	}
+	if !p.Role.Allows(e.role) {
+		return forbidden(fmt.Errorf("role %s is required", e.role))
+	}
+
+	return nil
 }
@@ -0,0 +1,284 @@
+package apiserver
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"github.com/geisonsn/go-and-compose/logging"
+	"github.com/geisonsn/go-and-compose/storage"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	AuthMethodAPIKey    = "api_key"
+	AuthMethodJWT       = "jwt"
+	AuthMethodAnonymous = "anonymous"
+
+	apiKeyHeader = "X-API-Key"
+)
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	// ID is the api key id or the token subject.
+	ID     string
+	Name   string
+	Method string
+	Role   storage.Role
+	// Owner is the owner_id of the items of the principal: the owner of the
+	// api key or the token subject, prefixed by Method so the two can't be
+	// mistaken for one another.
+	Owner string
+}
+
+// anonymous is the principal of every request when authentication is
+// disabled. It is a writer, so it can only reach the items it created.
+var anonymous = &Principal{ID: AuthMethodAnonymous, Name: AuthMethodAnonymous, Method: AuthMethodAnonymous, Role: storage.RoleWriter, Owner: AuthMethodAnonymous}
+
+// tokenClaims are the claims read from bearer tokens. Tokens without a role
+// are readers.
+type tokenClaims struct {
+	jwt.RegisteredClaims
+	Role storage.Role `json:"role,omitempty"`
+}
+
+type principalKey struct{}
+
+func withPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the caller authenticated by the auth
+// middleware, if any.
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
+
+// apiKeyStore is implemented by stores that can hold API keys.
+type apiKeyStore interface {
+	APIKeyByHash(ctx context.Context, hash string) (*storage.APIKey, error)
+}
+
+type authenticator struct {
+	keys       apiKeyStore
+	hmacSecret []byte
+	rsaKeys    map[string]*rsa.PublicKey
+	issuer     string
+	audience   string
+}
+
+func newAuthenticator(store ItemStore, opts Options) (*authenticator, error) {
+	a := &authenticator{
+		hmacSecret: []byte(opts.JWTHMACSecret),
+		issuer:     opts.JWTIssuer,
+		audience:   opts.JWTAudience,
+	}
+
+	if keys, ok := store.(apiKeyStore); ok {
+		a.keys = keys
+	}
+
+	if opts.JWKSFile != "" {
+		keys, err := loadJWKS(opts.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		a.rsaKeys = keys
+	}
+
+	return a, nil
+}
+
+// middleware rejects requests without valid credentials and stores the
+// Principal of the others in their context. Credentials are either an API key,
+// in X-API-Key or as a bearer token, or a JWT bearer token.
+func (a *authenticator) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		p, err := a.authenticate(req)
+		if err != nil {
+			apiErr := toAPIError(err)
+			if apiErr.Status == http.StatusUnauthorized {
+				logging.FromContext(req.Context()).WithError(err).Info("could not authenticate request")
+				w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+			} else {
+				logging.FromContext(req.Context()).WithError(err).Error("could not authenticate request")
+			}
+
+			writeJSON(w, apiErr.Status, errorEnvelope{Error: apiErr})
+			return
+		}
+
+		next.ServeHTTP(w, authenticated(req, p))
+	})
+}
+
+// allowAnonymous lets every request through as the anonymous principal.
+func allowAnonymous(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		next.ServeHTTP(w, authenticated(req, anonymous))
+	})
+}
+
+func authenticated(req *http.Request, p *Principal) *http.Request {
+	entry := logging.FromContext(req.Context()).WithField("principal", p.ID)
+	ctx := logging.WithLogger(withPrincipal(req.Context(), p), entry)
+	return req.WithContext(ctx)
+}
+
+// authenticate returns the caller of req. Bad or missing credentials are
+// unauthorized errors, anything else, such as the key store being down, is
+// returned as is.
+func (a *authenticator) authenticate(req *http.Request) (*Principal, error) {
+	if key := req.Header.Get(apiKeyHeader); key != "" {
+		return a.authenticateAPIKey(req.Context(), key)
+	}
+
+	parts := strings.SplitN(req.Header.Get("Authorization"), " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") || parts[1] == "" {
+		return nil, unauthorized(errors.New("missing bearer token or api key"))
+	}
+
+	token := parts[1]
+	if strings.HasPrefix(token, storage.APIKeyPrefix) {
+		return a.authenticateAPIKey(req.Context(), token)
+	}
+
+	p, err := a.authenticateJWT(token)
+	if err != nil {
+		return nil, unauthorized(err)
+	}
+
+	return p, nil
+}
+
+func (a *authenticator) authenticateAPIKey(ctx context.Context, key string) (*Principal, error) {
+	if a.keys == nil {
+		return nil, unauthorized(errors.New("api keys are not supported by this store"))
+	}
+
+	k, err := a.keys.APIKeyByHash(ctx, storage.HashAPIKey(key))
+	var notFound *storage.NotFoundError
+	if errors.As(err, &notFound) {
+		return nil, unauthorized(fmt.Errorf("invalid api key: %w", err))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not look up api key: %w", err)
+	}
+
+	return &Principal{ID: k.ID, Name: k.Name, Method: AuthMethodAPIKey, Role: k.Role, Owner: AuthMethodAPIKey + ":" + k.Owner}, nil
+}
+
+func (a *authenticator) authenticateJWT(raw string) (*Principal, error) {
+	var methods []string
+	if len(a.hmacSecret) > 0 {
+		methods = append(methods, "HS256", "HS384", "HS512")
+	}
+	if len(a.rsaKeys) > 0 {
+		methods = append(methods, "RS256")
+	}
+	if len(methods) == 0 {
+		return nil, errors.New("jwt authentication is not configured")
+	}
+
+	claims := &tokenClaims{}
+	parser := jwt.NewParser(jwt.WithValidMethods(methods))
+	if _, err := parser.ParseWithClaims(raw, claims, a.verificationKey); err != nil {
+		return nil, fmt.Errorf("invalid token: %w", err)
+	}
+
+	if a.issuer != "" && !claims.VerifyIssuer(a.issuer, true) {
+		return nil, errors.New("invalid token: unexpected issuer")
+	}
+	if a.audience != "" && !claims.VerifyAudience(a.audience, true) {
+		return nil, errors.New("invalid token: unexpected audience")
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("invalid token: missing subject")
+	}
+	if claims.Role == "" {
+		claims.Role = storage.RoleReader
+	}
+	if !claims.Role.Valid() {
+		return nil, fmt.Errorf("invalid token: unknown role %q", claims.Role)
+	}
+
+	return &Principal{ID: claims.Subject, Name: claims.Subject, Method: AuthMethodJWT, Role: claims.Role, Owner: AuthMethodJWT + ":" + claims.Subject}, nil
+}
+
+func (a *authenticator) verificationKey(t *jwt.Token) (interface{}, error) {
+	if _, ok := t.Method.(*jwt.SigningMethodHMAC); ok {
+		return a.hmacSecret, nil
+	}
+
+	kid, _ := t.Header["kid"].(string)
+	if key, ok := a.rsaKeys[kid]; ok {
+		return key, nil
+	}
+
+	// A JWKS with a single key can verify tokens that don't name one.
+	if kid == "" && len(a.rsaKeys) == 1 {
+		for _, key := range a.rsaKeys {
+			return key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+type jwks struct {
+	Keys []struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Use string `json:"use"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	} `json:"keys"`
+}
+
+// loadJWKS reads the RSA signing keys of a JWKS document, by key id.
+func loadJWKS(path string) (map[string]*rsa.PublicKey, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read jwks: %w", err)
+	}
+
+	var set jwks
+	if err := json.Unmarshal(b, &set); err != nil {
+		return nil, fmt.Errorf("could not decode jwks: %w", err)
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus for key %q: %w", k.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent for key %q: %w", k.Kid, err)
+		}
+
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no rsa signing keys found in %s", path)
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,43 @@
+package apiserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/geisonsn/go-and-compose/storage"
+)
+
+func TestItemsRequireCredentialsByDefault(t *testing.T) {
+	s := newTestServer(t, DefaultOptions())
+
+	rec := httptest.NewRecorder()
+	s.router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/items", nil))
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestAnonymousCannotReachOtherOwnersItems(t *testing.T) {
+	s := newTestServer(t, anonymousOptions())
+
+	item, err := s.storage.CreateItem(context.Background(), storage.CreateItemRequest{Name: "box", OwnerID: "api_key:someone"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/items/"+item.ID, nil),
+		httptest.NewRequest(http.MethodDelete, "/items/"+item.ID, nil),
+		httptest.NewRequest(http.MethodGet, "/items?owner_id=api_key:someone", nil),
+	} {
+		rec := httptest.NewRecorder()
+		s.router().ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusNotFound && rec.Code != http.StatusForbidden {
+			t.Errorf("expected %s %s to be denied, got %d: %s", req.Method, req.URL, rec.Code, rec.Body)
+		}
+	}
+}
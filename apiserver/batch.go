@@ -0,0 +1,133 @@
+package apiserver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/geisonsn/go-and-compose/logging"
+	"github.com/geisonsn/go-and-compose/storage"
+	"github.com/geisonsn/go-and-compose/validation"
+)
+
+const (
+	// batchModeAtomic creates every item of a batch or none of them.
+	batchModeAtomic = "atomic"
+	// batchModePartial creates the items it can and reports on each one.
+	batchModePartial = "partial"
+)
+
+type batchResponse struct {
+	Items []*storage.Item `json:"items"`
+}
+
+type partialBatchResponse struct {
+	Created int           `json:"created"`
+	Failed  int           `json:"failed"`
+	Results []batchResult `json:"results"`
+}
+
+// batchResult is the outcome of a single item of a partial batch, in the
+// order of the request.
+type batchResult struct {
+	Index int           `json:"index"`
+	Item  *storage.Item `json:"item,omitempty"`
+	Error *APIError     `json:"error,omitempty"`
+}
+
+// createItems creates the items of a JSON array. By default they are all
+// created in one transaction, and any invalid item fails the batch with its
+// index in the field names. ?mode=partial creates them one by one instead.
+func (s *APIServer) createItems(w http.ResponseWriter, req *http.Request) error {
+	mode := req.URL.Query().Get("mode")
+	if mode == "" {
+		mode = batchModeAtomic
+	}
+	if mode != batchModeAtomic && mode != batchModePartial {
+		return badRequest(fmt.Errorf("mode must be %s or %s", batchModeAtomic, batchModePartial))
+	}
+
+	var reqs []storage.CreateItemRequest
+	if err := decodeRequest(req, &reqs); err != nil {
+		return err
+	}
+	if len(reqs) == 0 {
+		return badRequest(errors.New("batch must have at least one item"))
+	}
+	if len(reqs) > s.opts.MaxBatchSize {
+		return batchTooLarge(s.opts.MaxBatchSize)
+	}
+
+	owner := principal(req).Owner
+	for i := range reqs {
+		reqs[i].OwnerID = owner
+	}
+
+	if mode == batchModePartial {
+		return s.createItemsPartially(w, req, reqs)
+	}
+
+	var invalid validation.Errors
+	for i := range reqs {
+		invalid = append(invalid, batchFieldErrors(i, reqs[i].Validate())...)
+	}
+	if len(invalid) > 0 {
+		return invalid
+	}
+
+	items, err := s.storage.CreateItems(req.Context(), reqs)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(w, http.StatusCreated, batchResponse{Items: items})
+}
+
+func (s *APIServer) createItemsPartially(w http.ResponseWriter, req *http.Request, reqs []storage.CreateItemRequest) error {
+	res := partialBatchResponse{Results: make([]batchResult, 0, len(reqs))}
+	for i := range reqs {
+		r := batchResult{Index: i}
+
+		err := reqs[i].Validate()
+		if err == nil {
+			r.Item, err = s.storage.CreateItem(req.Context(), reqs[i])
+		}
+		if err != nil {
+			r.Error = toAPIError(err)
+			if r.Error.Status >= http.StatusInternalServerError {
+				logging.FromContext(req.Context()).WithError(err).WithField("index", i).Error("could not create batch item")
+			}
+			res.Failed++
+		} else {
+			res.Created++
+		}
+
+		res.Results = append(res.Results, r)
+	}
+
+	return writeJSON(w, http.StatusOK, res)
+}
+
+// batchFieldErrors prefixes the fields of the validation errors of the item
+// at index i, so they point into the request array.
+func batchFieldErrors(i int, err error) validation.Errors {
+	var invalid validation.Errors
+	if !errors.As(err, &invalid) {
+		return nil
+	}
+
+	prefixed := make(validation.Errors, 0, len(invalid))
+	for _, f := range invalid {
+		prefixed = append(prefixed, validation.FieldError{Field: fmt.Sprintf("[%d].%s", i, f.Field), Message: f.Message})
+	}
+
+	return prefixed
+}
+
+func batchTooLarge(max int) *APIError {
+	return &APIError{
+		Status:  http.StatusRequestEntityTooLarge,
+		Code:    "batch_too_large",
+		Message: fmt.Sprintf("batch must not exceed %d items", max),
+	}
+}
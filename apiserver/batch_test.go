@@ -0,0 +1,61 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func postBatch(t *testing.T, s *APIServer, mode, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/items/batch?mode="+mode, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	s.router().ServeHTTP(rec, req)
+
+	return rec
+}
+
+func TestAtomicBatchNamesInvalidItemsByIndex(t *testing.T) {
+	opts := anonymousOptions()
+	opts.ValidateRequests = true
+	s := newTestServer(t, opts)
+
+	rec := postBatch(t, s, batchModeAtomic, `[{"name":"box"},{"name":""}]`)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %d: %s", rec.Code, rec.Body)
+	}
+
+	var res errorEnvelope
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Error.Details) == 0 || res.Error.Details[0].Field != "[1].name" {
+		t.Fatalf("expected details about [1].name, got %+v", res.Error.Details)
+	}
+}
+
+func TestPartialBatchReportsEachItem(t *testing.T) {
+	opts := anonymousOptions()
+	opts.ValidateRequests = true
+	s := newTestServer(t, opts)
+
+	rec := postBatch(t, s, batchModePartial, `[{"name":"box"},{"name":""}]`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+
+	var res partialBatchResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Created != 1 || res.Failed != 1 || len(res.Results) != 2 {
+		t.Fatalf("expected 1 created and 1 failed item, got %+v", res)
+	}
+	if res.Results[0].Item == nil || res.Results[1].Error == nil || res.Results[1].Error.Code != "validation_failed" {
+		t.Fatalf("expected the second item to fail validation, got %+v", res.Results)
+	}
+}
@@ -0,0 +1,271 @@
+package apiserver
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// docsTemplate renders the OpenAPI document as plain HTML. It has no scripts
+// and loads nothing else, so /docs works offline and under any CSP.
+var docsTemplate = template.Must(template.New("docs").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>{{.Title}}</title>
+</head>
+<body>
+  <h1>{{.Title}} {{.Version}}</h1>
+  <p>{{.Description}}</p>
+  <p>The OpenAPI document is served at <a href="/openapi.json">/openapi.json</a>.</p>
+
+  <h2>Operations</h2>
+  {{range .Operations}}
+  <section id="{{.ID}}">
+    <h3><code>{{.Method}} {{.Path}}</code></h3>
+    <p>{{.Summary}}</p>
+    {{with .Description}}<p>{{.}}</p>{{end}}
+    {{if not .Authenticated}}<p>No authentication required.</p>{{end}}
+    {{with .Parameters}}
+    <table>
+      <caption>Parameters</caption>
+      <tr><th>Name</th><th>In</th><th>Type</th><th>Required</th><th>Description</th></tr>
+      {{range .}}<tr><td><code>{{.Name}}</code></td><td>{{.In}}</td><td>{{.Type}}</td><td>{{if .Required}}yes{{end}}</td><td>{{.Description}}</td></tr>
+      {{end}}
+    </table>
+    {{end}}
+    {{with .Body}}<p>Request body: <code>{{.}}</code></p>{{end}}
+    <table>
+      <caption>Responses</caption>
+      <tr><th>Status</th><th>Body</th><th>Description</th></tr>
+      {{range .Responses}}<tr><td>{{.Status}}</td><td><code>{{.Body}}</code></td><td>{{.Description}}</td></tr>
+      {{end}}
+    </table>
+  </section>
+  {{end}}
+
+  <h2>Schemas</h2>
+  {{range .Schemas}}
+  <section id="schema-{{.Name}}">
+    <h3><code>{{.Name}}</code>: {{.Type}}</h3>
+    {{with .Description}}<p>{{.}}</p>{{end}}
+    {{with .Properties}}
+    <table>
+      <tr><th>Property</th><th>Type</th><th>Required</th><th>Description</th></tr>
+      {{range .}}<tr><td><code>{{.Name}}</code></td><td>{{.Type}}</td><td>{{if .Required}}yes{{end}}</td><td>{{.Description}}</td></tr>
+      {{end}}
+    </table>
+    {{end}}
+  </section>
+  {{end}}
+</body>
+</html>
+`))
+
+// docsMethods orders the operations of a path.
+var docsMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+type docsPage struct {
+	Title       string
+	Version     string
+	Description string
+	Operations  []docsOperation
+	Schemas     []docsSchema
+}
+
+type docsOperation struct {
+	ID            string
+	Method        string
+	Path          string
+	Summary       string
+	Description   string
+	Authenticated bool
+	Parameters    []docsField
+	Body          string
+	Responses     []docsResponse
+}
+
+type docsField struct {
+	Name        string
+	In          string
+	Type        string
+	Required    bool
+	Description string
+}
+
+type docsResponse struct {
+	Status      string
+	Body        string
+	Description string
+}
+
+type docsSchema struct {
+	Name        string
+	Type        string
+	Description string
+	Properties  []docsField
+}
+
+// renderDocs renders the documentation page of doc.
+func renderDocs(doc *openapi3.T) ([]byte, error) {
+	page := docsPage{Title: doc.Info.Title, Version: doc.Info.Version, Description: doc.Info.Description}
+
+	paths := make([]string, 0, len(doc.Paths))
+	for path := range doc.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		item := doc.Paths[path]
+		for _, method := range docsMethods {
+			op := item.GetOperation(method)
+			if op == nil {
+				continue
+			}
+
+			security := doc.Security
+			if op.Security != nil {
+				security = *op.Security
+			}
+
+			o := docsOperation{
+				ID:            op.OperationID,
+				Method:        method,
+				Path:          path,
+				Summary:       op.Summary,
+				Description:   op.Description,
+				Authenticated: len(security) > 0,
+			}
+			for _, p := range op.Parameters {
+				o.Parameters = append(o.Parameters, docsField{
+					Name:        p.Value.Name,
+					In:          p.Value.In,
+					Type:        schemaType(p.Value.Schema),
+					Required:    p.Value.Required,
+					Description: p.Value.Description,
+				})
+			}
+			if op.RequestBody != nil {
+				o.Body = contentType(op.RequestBody.Value.Content)
+			}
+
+			statuses := make([]string, 0, len(op.Responses))
+			for status := range op.Responses {
+				statuses = append(statuses, status)
+			}
+			sort.Strings(statuses)
+			for _, status := range statuses {
+				r := op.Responses[status].Value
+				res := docsResponse{Status: status, Body: contentType(r.Content)}
+				if r.Description != nil {
+					res.Description = *r.Description
+				}
+				o.Responses = append(o.Responses, res)
+			}
+
+			page.Operations = append(page.Operations, o)
+		}
+	}
+
+	names := make([]string, 0, len(doc.Components.Schemas))
+	for name := range doc.Components.Schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		s := doc.Components.Schemas[name].Value
+		schema := docsSchema{Name: name, Type: schemaType(&openapi3.SchemaRef{Value: s}), Description: s.Description}
+
+		props := make([]string, 0, len(s.Properties))
+		for prop := range s.Properties {
+			props = append(props, prop)
+		}
+		sort.Strings(props)
+		for _, prop := range props {
+			p := s.Properties[prop]
+			schema.Properties = append(schema.Properties, docsField{
+				Name:        prop,
+				Type:        schemaType(p),
+				Required:    contains(s.Required, prop),
+				Description: p.Value.Description,
+			})
+		}
+
+		page.Schemas = append(page.Schemas, schema)
+	}
+
+	var b bytes.Buffer
+	if err := docsTemplate.Execute(&b, page); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+// schemaType names a schema by its component, or describes it by its type.
+func schemaType(ref *openapi3.SchemaRef) string {
+	if ref == nil {
+		return ""
+	}
+	if ref.Ref != "" {
+		return ref.Ref[strings.LastIndex(ref.Ref, "/")+1:]
+	}
+
+	s := ref.Value
+	switch {
+	case s.Type == "array":
+		return "array of " + schemaType(s.Items)
+	case len(s.Enum) > 0:
+		values := make([]string, 0, len(s.Enum))
+		for _, v := range s.Enum {
+			if str, ok := v.(string); ok {
+				values = append(values, str)
+			}
+		}
+		return s.Type + " (" + strings.Join(values, ", ") + ")"
+	case s.Format != "":
+		return s.Type + " (" + s.Format + ")"
+	}
+
+	return s.Type
+}
+
+// contentType describes the body of a request or response by its media type
+// and schema.
+func contentType(content openapi3.Content) string {
+	types := make([]string, 0, len(content))
+	for mime, mt := range content {
+		types = append(types, mime+" "+schemaType(mt.Schema))
+	}
+	sort.Strings(types)
+
+	return strings.Join(types, ", ")
+}
+
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *APIServer) docs(w http.ResponseWriter, req *http.Request) error {
+	page, err := renderDocs(s.openAPI)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(page)
+	return err
+}
@@ -0,0 +1,82 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+)
+
+const contentTypeJSON = "application/json"
+
+// decodeRequest reads the request body into v. JSON bodies are decoded
+// directly, anything else is parsed as a form and its fields are matched
+// against v's json tags, so older clients posting forms keep working.
+func decodeRequest(req *http.Request, v interface{}) error {
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if mediaType == contentTypeJSON {
+		dec := json.NewDecoder(req.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(v); err != nil {
+			return decodeError(req, fmt.Errorf("could not decode json body: %w", err))
+		}
+
+		return nil
+	}
+
+	if err := req.ParseForm(); err != nil {
+		return decodeError(req, fmt.Errorf("could not parse form: %w", err))
+	}
+
+	fields := make(map[string]string, len(req.PostForm))
+	for k := range req.PostForm {
+		fields[k] = req.PostForm.Get(k)
+	}
+
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(b, v); err != nil {
+		return badRequest(fmt.Errorf("could not decode form: %w", err))
+	}
+
+	return nil
+}
+
+// decodeError reports a body over the size limit as such, anything else as a
+// bad request.
+func decodeError(req *http.Request, err error) error {
+	if body, ok := req.Body.(*limitedBody); ok && errors.Is(err, errBodyTooLarge) {
+		return bodyTooLarge(body.max)
+	}
+
+	return badRequest(err)
+}
+
+// validator is implemented by request structs that check their own fields.
+type validator interface {
+	Validate() error
+}
+
+// decodeAndValidate decodes the request body into v and, if v knows how to,
+// validates it before any storage call is made.
+func decodeAndValidate(req *http.Request, v interface{}) error {
+	if err := decodeRequest(req, v); err != nil {
+		return err
+	}
+
+	if val, ok := v.(validator); ok {
+		return val.Validate()
+	}
+
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) error {
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.WriteHeader(status)
+	return json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,119 @@
+package apiserver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/geisonsn/go-and-compose/storage"
+	"github.com/geisonsn/go-and-compose/validation"
+)
+
+// StatusClientClosedRequest is the non-standard status used when the client
+// goes away before the request is complete.
+const StatusClientClosedRequest = 499
+
+// APIError is an error that can be rendered to clients. Handlers return it to
+// control the status code and body, other errors are mapped by toAPIError.
+type APIError struct {
+	Status  int          `json:"-"`
+	Code    string       `json:"code"`
+	Message string       `json:"message"`
+	Details []FieldError `json:"details,omitempty"`
+
+	err error
+}
+
+// FieldError describes a problem with a single request field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type errorEnvelope struct {
+	Error *APIError `json:"error"`
+}
+
+func NewAPIError(status int, code, message string) *APIError {
+	return &APIError{Status: status, Code: code, Message: message}
+}
+
+func (e *APIError) Error() string {
+	if e.err != nil {
+		return e.Message + ": " + e.err.Error()
+	}
+
+	return e.Message
+}
+
+func (e *APIError) Unwrap() error {
+	return e.err
+}
+
+// WithDetails returns a copy of e carrying the given field errors.
+func (e *APIError) WithDetails(details ...FieldError) *APIError {
+	c := *e
+	c.Details = append(append([]FieldError{}, e.Details...), details...)
+	return &c
+}
+
+func badRequest(err error) *APIError {
+	return &APIError{Status: http.StatusBadRequest, Code: "bad_request", Message: err.Error(), err: err}
+}
+
+func unauthorized(err error) *APIError {
+	return &APIError{Status: http.StatusUnauthorized, Code: "unauthorized", Message: "authentication required", err: err}
+}
+
+func forbidden(err error) *APIError {
+	return &APIError{Status: http.StatusForbidden, Code: "forbidden", Message: err.Error(), err: err}
+}
+
+// routeNotFound answers requests to paths no route matches.
+func routeNotFound(w http.ResponseWriter, req *http.Request) error {
+	return &APIError{Status: http.StatusNotFound, Code: "not_found", Message: "no route for " + req.URL.Path}
+}
+
+// methodNotAllowed answers requests to a known path with a method it doesn't
+// accept.
+func methodNotAllowed(w http.ResponseWriter, req *http.Request) error {
+	return &APIError{Status: http.StatusMethodNotAllowed, Code: "method_not_allowed", Message: req.Method + " is not allowed on " + req.URL.Path}
+}
+
+// toAPIError maps err, and the storage errors it may wrap, to an APIError.
+// Anything unrecognised becomes an opaque internal error.
+func toAPIError(err error) *APIError {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	var invalid validation.Errors
+	if errors.As(err, &invalid) {
+		details := make([]FieldError, 0, len(invalid))
+		for _, f := range invalid {
+			details = append(details, FieldError{Field: f.Field, Message: f.Message})
+		}
+
+		return &APIError{Status: http.StatusUnprocessableEntity, Code: "validation_failed", Message: "request is invalid", Details: details, err: err}
+	}
+
+	var notFound *storage.NotFoundError
+	if errors.As(err, &notFound) {
+		return &APIError{Status: http.StatusNotFound, Code: "not_found", Message: notFound.Error(), err: err}
+	}
+
+	var conflict *storage.ConflictError
+	if errors.As(err, &conflict) {
+		return &APIError{Status: http.StatusConflict, Code: "conflict", Message: conflict.Error(), err: err}
+	}
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return &APIError{Status: StatusClientClosedRequest, Code: "client_closed_request", Message: "request canceled", err: err}
+	case errors.Is(err, context.DeadlineExceeded):
+		return &APIError{Status: http.StatusGatewayTimeout, Code: "timeout", Message: "request timed out", err: err}
+	}
+
+	return &APIError{Status: http.StatusInternalServerError, Code: "internal", Message: "internal server error", err: err}
+}
@@ -0,0 +1,38 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUnroutedRequestsGetErrorEnvelopes(t *testing.T) {
+	s := newTestServer(t, DefaultOptions())
+
+	cases := []struct {
+		method string
+		target string
+		status int
+		code   string
+	}{
+		{http.MethodGet, "/nothing", http.StatusNotFound, "not_found"},
+		{http.MethodGet, "/items/a/b", http.StatusNotFound, "not_found"},
+		{http.MethodPost, "/healthz", http.StatusMethodNotAllowed, "method_not_allowed"},
+		{http.MethodDelete, "/items", http.StatusMethodNotAllowed, "method_not_allowed"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.method+" "+tc.target, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			s.router().ServeHTTP(rec, httptest.NewRequest(tc.method, tc.target, nil))
+
+			var res errorEnvelope
+			if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil || res.Error == nil {
+				t.Fatalf("expected an error envelope, got %q", rec.Body)
+			}
+			if rec.Code != tc.status || res.Error.Code != tc.code {
+				t.Fatalf("expected %d %s, got %d %s", tc.status, tc.code, rec.Code, res.Error.Code)
+			}
+		})
+	}
+}
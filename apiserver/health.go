@@ -0,0 +1,82 @@
+package apiserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+var readinessCheckTimeout = time.Second * 2
+
+const (
+	healthStatusOK          = "ok"
+	healthStatusUnavailable = "unavailable"
+)
+
+type healthResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]healthCheck `json:"checks,omitempty"`
+}
+
+type healthCheck struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// healthz reports that the process is up and serving requests.
+func (s *APIServer) healthz(w http.ResponseWriter, req *http.Request) error {
+	return writeJSON(w, http.StatusOK, healthResponse{Status: healthStatusOK})
+}
+
+// readyz reports whether the server should receive traffic: it isn't
+// shutting down, the database answers and its schema is up to date.
+func (s *APIServer) readyz(w http.ResponseWriter, req *http.Request) error {
+	ctx, cancel := context.WithTimeout(req.Context(), readinessCheckTimeout)
+	defer cancel()
+
+	res := healthResponse{Status: healthStatusOK, Checks: map[string]healthCheck{}}
+	check := func(name string, err error) {
+		if err != nil {
+			res.Status = healthStatusUnavailable
+			res.Checks[name] = healthCheck{Status: healthStatusUnavailable, Error: err.Error()}
+			return
+		}
+
+		res.Checks[name] = healthCheck{Status: healthStatusOK}
+	}
+
+	var drainErr error
+	if atomic.LoadInt32(&s.draining) == 1 {
+		drainErr = fmt.Errorf("server is shutting down")
+	}
+	check("server", drainErr)
+	check("database", s.storage.Ping(ctx))
+	check("migrations", s.checkMigrations(ctx))
+
+	status := http.StatusOK
+	if res.Status != healthStatusOK {
+		status = http.StatusServiceUnavailable
+	}
+
+	return writeJSON(w, status, res)
+}
+
+func (s *APIServer) checkMigrations(ctx context.Context) error {
+	checker, ok := s.storage.(migrationChecker)
+	if !ok {
+		return nil
+	}
+
+	pending, err := checker.PendingMigrations(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(pending) > 0 {
+		return fmt.Errorf("%d pending migrations, first is %d_%s", len(pending), pending[0].Version, pending[0].Name)
+	}
+
+	return nil
+}
@@ -0,0 +1,147 @@
+package apiserver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/geisonsn/go-and-compose/storage"
+	"github.com/gorilla/mux"
+)
+
+func (s *APIServer) createItem(w http.ResponseWriter, req *http.Request) error {
+	var create storage.CreateItemRequest
+	if err := decodeAndValidate(req, &create); err != nil {
+		return err
+	}
+
+	create.OwnerID = principal(req).Owner
+	item, err := s.storage.CreateItem(req.Context(), create)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Location", "/items/"+item.ID)
+	return writeJSON(w, http.StatusCreated, item)
+}
+
+func (s *APIServer) listItems(w http.ResponseWriter, req *http.Request) error {
+	params := req.URL.Query()
+	q := storage.ListItemsQuery{
+		Cursor:       params.Get("cursor"),
+		Sort:         params.Get("sort"),
+		Direction:    params.Get("order"),
+		NamePrefix:   params.Get("name_prefix"),
+		NameContains: params.Get("name_contains"),
+		OwnerID:      params.Get("owner_id"),
+	}
+
+	// Only admins can list the items of other owners, or of every owner by
+	// leaving owner_id out.
+	if p := principal(req); !p.Role.Allows(storage.RoleAdmin) {
+		if q.OwnerID != "" && q.OwnerID != p.Owner {
+			return forbidden(errors.New("cannot list the items of another owner"))
+		}
+		q.OwnerID = p.Owner
+	}
+
+	if limit := params.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			return badRequest(fmt.Errorf("limit must be an integer: %w", err))
+		}
+		q.Limit = n
+	}
+
+	page, err := s.storage.ListItems(req.Context(), q)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(w, http.StatusOK, page)
+}
+
+func (s *APIServer) getItem(w http.ResponseWriter, req *http.Request) error {
+	item, err := s.ownedItem(req)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(w, http.StatusOK, item)
+}
+
+func (s *APIServer) replaceItem(w http.ResponseWriter, req *http.Request) error {
+	var create storage.CreateItemRequest
+	if err := decodeAndValidate(req, &create); err != nil {
+		return err
+	}
+
+	if _, err := s.ownedItem(req); err != nil {
+		return err
+	}
+
+	item, err := s.storage.UpdateItem(req.Context(), mux.Vars(req)["id"], storage.UpdateItemRequest{
+		Name: &create.Name,
+	})
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(w, http.StatusOK, item)
+}
+
+func (s *APIServer) updateItem(w http.ResponseWriter, req *http.Request) error {
+	var update storage.UpdateItemRequest
+	if err := decodeAndValidate(req, &update); err != nil {
+		return err
+	}
+
+	if _, err := s.ownedItem(req); err != nil {
+		return err
+	}
+
+	item, err := s.storage.UpdateItem(req.Context(), mux.Vars(req)["id"], update)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(w, http.StatusOK, item)
+}
+
+func (s *APIServer) deleteItem(w http.ResponseWriter, req *http.Request) error {
+	if _, err := s.ownedItem(req); err != nil {
+		return err
+	}
+
+	if err := s.storage.DeleteItem(req.Context(), mux.Vars(req)["id"]); err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// ownedItem returns the item of the route if the caller can act on it. The
+// items of other owners don't exist as far as non-admins can tell. Owners
+// never change, so the check holds for the update or delete that follows.
+func (s *APIServer) ownedItem(req *http.Request) (*storage.Item, error) {
+	id := mux.Vars(req)["id"]
+	item, err := s.storage.GetItem(req.Context(), id)
+	if err != nil {
+		return nil, err
+	}
+
+	if p := principal(req); item.OwnerID != p.Owner && !p.Role.Allows(storage.RoleAdmin) {
+		return nil, &storage.NotFoundError{Resource: "item", ID: id}
+	}
+
+	return item, nil
+}
+
+// principal returns the caller of an item route, which Endpoint has already
+// checked is there.
+func principal(req *http.Request) *Principal {
+	p, _ := PrincipalFromContext(req.Context())
+	return p
+}
@@ -0,0 +1,74 @@
+package apiserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+var errBodyTooLarge = errors.New("request body too large")
+
+// limitBodies rejects requests whose declared length is over max and stops
+// reading the others once they go over it.
+func limitBodies(max int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.ContentLength > max {
+				writeJSON(w, http.StatusRequestEntityTooLarge, errorEnvelope{Error: bodyTooLarge(max)})
+				return
+			}
+
+			req.Body = &limitedBody{ReadCloser: req.Body, max: max, remaining: max}
+			next.ServeHTTP(w, req)
+		})
+	}
+}
+
+// timeoutHandlers bounds every request's context, so storage calls are
+// canceled once the handler has used up its time.
+func timeoutHandlers(timeout time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			ctx, cancel := context.WithTimeout(req.Context(), timeout)
+			defer cancel()
+
+			next.ServeHTTP(w, req.WithContext(ctx))
+		})
+	}
+}
+
+func bodyTooLarge(max int64) *APIError {
+	return &APIError{
+		Status:  http.StatusRequestEntityTooLarge,
+		Code:    "body_too_large",
+		Message: fmt.Sprintf("request body must not exceed %d bytes", max),
+		err:     errBodyTooLarge,
+	}
+}
+
+// limitedBody returns errBodyTooLarge once more than remaining bytes are
+// read from it.
+type limitedBody struct {
+	io.ReadCloser
+	max       int64
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	if int64(n) > b.remaining {
+		n = int(b.remaining)
+		b.remaining = 0
+		return n, errBodyTooLarge
+	}
+
+	b.remaining -= int64(n)
+	return n, err
+}
@@ -0,0 +1,57 @@
+package apiserver
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/geisonsn/go-and-compose/logging"
+	"github.com/sirupsen/logrus"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// requestIDPattern limits which client supplied ids are trusted, so they can
+// be logged and echoed back safely.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// logRequests assigns every request an id, propagating the caller's one when
+// given, stores a logger carrying it in the request context and writes an
+// access log entry once the request is complete.
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		id := req.Header.Get(requestIDHeader)
+		if !requestIDPattern.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+
+		entry := logrus.WithFields(logrus.Fields{
+			"request_id": id,
+			"method":     req.Method,
+			"path":       req.URL.Path,
+		})
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, req.WithContext(logging.WithLogger(req.Context(), entry)))
+
+		entry.WithFields(logrus.Fields{
+			"status":      rec.status,
+			"duration":    time.Since(start),
+			"bytes":       rec.bytes,
+			"remote_addr": req.RemoteAddr,
+		}).Info("request completed")
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,136 @@
+package apiserver
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+type metrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+}
+
+func newMetrics(s dbStatser) *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "Number of HTTP requests by route, method and status code.",
+		}, []string{"route", "method", "code"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "Latency of HTTP requests by route and method.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+	}
+
+	m.registry.MustRegister(
+		m.requests,
+		m.requestDuration,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	m.registry.MustRegister(dbStatsCollectors(s)...)
+
+	return m
+}
+
+func (m *metrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// instrument records every request served by router, labelled with the
+// route template rather than the path so ids don't explode the label
+// cardinality. It wraps the router, rather than being one of its middlewares,
+// so requests no route matches are counted too, as the unknown route.
+func (m *metrics) instrument(router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		route := "unknown"
+		var match mux.RouteMatch
+		if router.Match(req, &match) && match.MatchErr == nil && match.Route != nil {
+			if tpl, err := match.Route.GetPathTemplate(); err == nil {
+				route = tpl
+			}
+		}
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		router.ServeHTTP(rec, req)
+
+		m.requests.WithLabelValues(route, req.Method, strconv.Itoa(rec.status)).Inc()
+		m.requestDuration.WithLabelValues(route, req.Method).Observe(time.Since(start).Seconds())
+	})
+}
+
+type dbStatser interface {
+	Stats() sql.DBStats
+}
+
+// dbStatsCollectors exposes the connection pool statistics of s.
+func dbStatsCollectors(s dbStatser) []prometheus.Collector {
+	gauge := func(name, help string, value func() float64) prometheus.Collector {
+		return prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: "db_" + name, Help: help}, value)
+	}
+	counter := func(name, help string, value func() float64) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{Name: "db_" + name, Help: help}, value)
+	}
+
+	return []prometheus.Collector{
+		gauge("max_open_connections", "Maximum number of open connections to the database.", func() float64 {
+			return float64(s.Stats().MaxOpenConnections)
+		}),
+		gauge("open_connections", "Number of established connections, both in use and idle.", func() float64 {
+			return float64(s.Stats().OpenConnections)
+		}),
+		gauge("in_use_connections", "Number of connections currently in use.", func() float64 {
+			return float64(s.Stats().InUse)
+		}),
+		gauge("idle_connections", "Number of idle connections.", func() float64 {
+			return float64(s.Stats().Idle)
+		}),
+		counter("wait_count_total", "Total number of connections waited for.", func() float64 {
+			return float64(s.Stats().WaitCount)
+		}),
+		counter("wait_duration_seconds_total", "Total time blocked waiting for a new connection.", func() float64 {
+			return s.Stats().WaitDuration.Seconds()
+		}),
+		counter("max_idle_closed_total", "Total number of connections closed due to SetMaxIdleConns.", func() float64 {
+			return float64(s.Stats().MaxIdleClosed)
+		}),
+		counter("max_lifetime_closed_total", "Total number of connections closed due to SetConnMaxLifetime.", func() float64 {
+			return float64(s.Stats().MaxLifetimeClosed)
+		}),
+	}
+}
+
+// statusRecorder captures the status code and body size written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
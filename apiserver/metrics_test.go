@@ -0,0 +1,35 @@
+package apiserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetricsCountUnroutedRequests(t *testing.T) {
+	s := newTestServer(t, DefaultOptions())
+	handler := s.router()
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/nothing", nil),
+		httptest.NewRequest(http.MethodDelete, "/items", nil),
+		httptest.NewRequest(http.MethodGet, "/healthz", nil),
+	} {
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	cases := []struct {
+		route, method, code string
+	}{
+		{"unknown", http.MethodGet, "404"},
+		{"unknown", http.MethodDelete, "405"},
+		{"/healthz", http.MethodGet, "200"},
+	}
+	for _, tc := range cases {
+		if n := testutil.ToFloat64(s.metrics.requests.WithLabelValues(tc.route, tc.method, tc.code)); n != 1 {
+			t.Errorf("expected 1 %s %s request with %s, got %v", tc.method, tc.route, tc.code, n)
+		}
+	}
+}
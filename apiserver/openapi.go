@@ -0,0 +1,394 @@
+package apiserver
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/geisonsn/go-and-compose/logging"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/gorilla/mux"
+)
+
+// openAPISpec describes every route of the router. TestRoutesDocumented
+// fails when one is missing, and NewAPIServer refuses to start.
+//
+//go:embed openapi.yaml
+var openAPISpec []byte
+
+// OpenAPI returns the OpenAPI document of the API.
+func OpenAPI() (*openapi3.T, error) {
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromData(openAPISpec)
+	if err != nil {
+		return nil, fmt.Errorf("could not load openapi document: %w", err)
+	}
+
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, fmt.Errorf("invalid openapi document: %w", err)
+	}
+
+	return doc, nil
+}
+
+// checkRoutesDocumented returns an error naming the routes of router that
+// have no operation in doc. Routes without methods only need their path.
+func checkRoutesDocumented(router *mux.Router, doc *openapi3.T) error {
+	var missing []string
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		tpl, err := route.GetPathTemplate()
+		if err != nil {
+			// Subrouters only have a prefix, their routes are walked too.
+			return nil
+		}
+
+		methods, err := route.GetMethods()
+		if err != nil {
+			if route.GetHandler() != nil && doc.Paths.Find(tpl) == nil {
+				missing = append(missing, tpl)
+			}
+			return nil
+		}
+
+		path := doc.Paths.Find(tpl)
+		for _, m := range methods {
+			if path == nil || path.GetOperation(m) == nil {
+				missing = append(missing, m+" "+tpl)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("routes missing from the openapi document: %s", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+func (s *APIServer) openAPIDocument(w http.ResponseWriter, req *http.Request) error {
+	return writeJSON(w, http.StatusOK, s.openAPI)
+}
+
+// contract checks requests, responses or both against the OpenAPI document
+// so the handlers and the document can't drift apart.
+type contract struct {
+	router    routers.Router
+	requests  bool
+	responses bool
+}
+
+func newContract(doc *openapi3.T, validateRequests, validateResponses bool) (*contract, error) {
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, fmt.Errorf("could not route openapi document: %w", err)
+	}
+
+	return &contract{router: router, requests: validateRequests, responses: validateResponses}, nil
+}
+
+// valueKeywords are the schema keywords checking the value of a field rather
+// than the shape of the body.
+var valueKeywords = map[string]bool{
+	"minLength":        true,
+	"maxLength":        true,
+	"pattern":          true,
+	"format":           true,
+	"enum":             true,
+	"minimum":          true,
+	"maximum":          true,
+	"exclusiveMinimum": true,
+	"exclusiveMaximum": true,
+	"multipleOf":       true,
+}
+
+// middleware checks requests against the document when request validation
+// is on. Parameters, and bodies of the wrong type or shape, get a 400
+// invalid_request; bodies whose only problems are field values get the 422
+// validation_failed the handlers answer, except in partial batches, which
+// report invalid items one by one. Bodies are checked as the handlers decode
+// them, trimmed, and the handlers still get them as sent. With response
+// validation on, responses are buffered and replaced by a 500 when they don't
+// match it. Credentials are checked by the auth middleware, not here.
+func (c *contract) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		route, params, err := c.router.FindRoute(req)
+		if err != nil {
+			// Not documented, mux answers 404 or 405 itself.
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		input := &openapi3filter.RequestValidationInput{
+			Request:    req,
+			PathParams: params,
+			Route:      route,
+			Options: &openapi3filter.Options{
+				MultiError:         true,
+				AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+			},
+		}
+
+		if c.requests {
+			if apiErr := c.validateRequest(input); apiErr != nil {
+				writeJSON(w, apiErr.Status, errorEnvelope{Error: apiErr})
+				return
+			}
+		}
+
+		if !c.responses {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		rec := newResponseBuffer()
+		next.ServeHTTP(rec, req)
+
+		err = openapi3filter.ValidateResponse(req.Context(), &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: input,
+			Status:                 rec.status,
+			Header:                 rec.header,
+			Body:                   ioutil.NopCloser(bytes.NewReader(rec.body.Bytes())),
+			Options:                &openapi3filter.Options{MultiError: true, IncludeResponseStatus: true},
+		})
+		if err != nil {
+			logging.FromContext(req.Context()).WithError(err).Error("response does not match the openapi document")
+			apiErr := &APIError{Status: http.StatusInternalServerError, Code: "invalid_response", Message: "response does not match the api contract", err: err}
+			writeJSON(w, apiErr.Status, errorEnvelope{Error: apiErr})
+			return
+		}
+
+		rec.flush(w)
+	})
+}
+
+// validateRequest checks the request of input, and its body as the handler
+// will decode it. The body is read into memory and put back for the handler.
+func (c *contract) validateRequest(input *openapi3filter.RequestValidationInput) *APIError {
+	req := input.Request
+	if input.Route.Operation.RequestBody != nil && req.Body != nil {
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return toAPIError(decodeError(req, err))
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		decoded, mediaType := decodedBody(input.Route.Operation.RequestBody.Value.Content, req.Header.Get("Content-Type"), body)
+		vreq := req.Clone(req.Context())
+		vreq.Body = ioutil.NopCloser(bytes.NewReader(decoded))
+		vreq.ContentLength = int64(len(decoded))
+		vreq.Header.Set("Content-Type", mediaType)
+		input.Request = vreq
+		defer func() { input.Request = req }()
+	}
+
+	err := openapi3filter.ValidateRequest(req.Context(), input)
+	if err == nil {
+		return nil
+	}
+	if !valueErrorsOnly(err) {
+		return invalidRequest(err)
+	}
+	if input.Route.Operation.OperationID == "createItems" && req.URL.Query().Get("mode") == batchModePartial {
+		return nil
+	}
+
+	return &APIError{
+		Status:  http.StatusUnprocessableEntity,
+		Code:    "validation_failed",
+		Message: "request is invalid",
+		Details: contractDetails("", err),
+		err:     err,
+	}
+}
+
+// decodedBody returns body as the handlers decode it, see decodeRequest: JSON
+// as is and forms as a JSON object of the fields content describes, with
+// every string trimmed as the handlers trim them before checking them.
+// Anything else, including JSON that doesn't parse, is returned unchanged for
+// the validation to reject.
+func decodedBody(content openapi3.Content, contentType string, body []byte) ([]byte, string) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	var v interface{}
+	switch mediaType {
+	case contentTypeJSON:
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		if err := dec.Decode(&v); err != nil {
+			return body, contentType
+		}
+	case "application/x-www-form-urlencoded":
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return body, contentType
+		}
+		mt := content.Get(mediaType)
+		if mt == nil || mt.Schema == nil {
+			return body, contentType
+		}
+		// Like decodeRequest, fields nothing reads are ignored.
+		fields := make(map[string]interface{}, len(values))
+		for k := range values {
+			if _, ok := mt.Schema.Value.Properties[k]; ok {
+				fields[k] = values.Get(k)
+			}
+		}
+		v = fields
+	default:
+		return body, contentType
+	}
+
+	b, err := json.Marshal(trimStrings(v))
+	if err != nil {
+		return body, contentType
+	}
+
+	return b, contentTypeJSON
+}
+
+func trimStrings(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case []interface{}:
+		for i := range v {
+			v[i] = trimStrings(v[i])
+		}
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = trimStrings(v[k])
+		}
+	}
+
+	return v
+}
+
+// valueErrorsOnly reports whether every error of err is about the value of
+// a body field, rather than a parameter or the shape of the body.
+func valueErrorsOnly(err error) bool {
+	switch e := err.(type) {
+	case openapi3.MultiError:
+		for _, err := range e {
+			if !valueErrorsOnly(err) {
+				return false
+			}
+		}
+		return len(e) > 0
+	case *openapi3filter.RequestError:
+		return e.RequestBody != nil && e.Err != nil && valueErrorsOnly(e.Err)
+	case *openapi3.SchemaError:
+		return valueKeywords[e.SchemaField]
+	}
+
+	return false
+}
+
+func invalidRequest(err error) *APIError {
+	return &APIError{
+		Status:  http.StatusBadRequest,
+		Code:    "invalid_request",
+		Message: "request does not match the api contract",
+		Details: contractDetails("", err),
+		err:     err,
+	}
+}
+
+// contractDetails flattens the errors of the openapi3filter validation into
+// one FieldError per problem, named after the parameter or body field.
+func contractDetails(field string, err error) []FieldError {
+	switch e := err.(type) {
+	case openapi3.MultiError:
+		var details []FieldError
+		for _, err := range e {
+			details = append(details, contractDetails(field, err)...)
+		}
+		return details
+	case *openapi3filter.RequestError:
+		switch {
+		case e.Parameter != nil:
+			field = e.Parameter.Name
+		case e.RequestBody != nil:
+			field = "body"
+		}
+		if e.Err == nil {
+			return []FieldError{{Field: field, Message: e.Reason}}
+		}
+		return contractDetails(field, e.Err)
+	case *openapi3.SchemaError:
+		if p := e.JSONPointer(); len(p) > 0 {
+			field = bodyField(p)
+		}
+		msg := e.Reason
+		if msg == "" {
+			msg = e.Error()
+		}
+		return []FieldError{{Field: field, Message: msg}}
+	}
+
+	return []FieldError{{Field: field, Message: err.Error()}}
+}
+
+// bodyField names the field at pointer the way the handlers do, e.g.
+// [3].name for the name of the fourth item of a batch.
+func bodyField(pointer []string) string {
+	var b strings.Builder
+	for _, p := range pointer {
+		if _, err := strconv.Atoi(p); err == nil {
+			b.WriteString("[" + p + "]")
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(p)
+	}
+
+	return b.String()
+}
+
+// responseBuffer holds a response until it has been validated.
+type responseBuffer struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newResponseBuffer() *responseBuffer {
+	return &responseBuffer{header: http.Header{}, status: http.StatusOK}
+}
+
+func (b *responseBuffer) Header() http.Header {
+	return b.header
+}
+
+func (b *responseBuffer) WriteHeader(status int) {
+	b.status = status
+}
+
+func (b *responseBuffer) Write(p []byte) (int, error) {
+	return b.body.Write(p)
+}
+
+func (b *responseBuffer) flush(w http.ResponseWriter) {
+	for k, v := range b.header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(b.status)
+	w.Write(b.body.Bytes())
+}
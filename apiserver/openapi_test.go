@@ -0,0 +1,135 @@
+package apiserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/geisonsn/go-and-compose/storage"
+)
+
+func newTestServer(t *testing.T, opts Options) *APIServer {
+	t.Helper()
+
+	s, err := NewAPIServer(":0", storage.NewMemoryStorage(), opts)
+	if err != nil {
+		t.Fatalf("could not create server: %v", err)
+	}
+
+	return s
+}
+
+// anonymousOptions are the default options with authentication turned off, so
+// tests can reach the item routes without credentials.
+func anonymousOptions() Options {
+	opts := DefaultOptions()
+	opts.AuthEnabled = false
+
+	return opts
+}
+
+func TestRoutesDocumented(t *testing.T) {
+	opts := DefaultOptions()
+	opts.ValidateRequests = true
+	s := newTestServer(t, opts)
+
+	if err := checkRoutesDocumented(s.routes(), s.openAPI); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRoutesDocumentedReportsMissingRoutes(t *testing.T) {
+	s := newTestServer(t, DefaultOptions())
+
+	router := s.routes()
+	router.Methods("GET").Path("/undocumented").Handler(Endpoint{handler: s.healthz})
+	router.Methods("DELETE").Path("/healthz").Handler(Endpoint{handler: s.healthz})
+
+	err := checkRoutesDocumented(router, s.openAPI)
+	if err == nil {
+		t.Fatal("expected undocumented routes to be reported")
+	}
+	for _, route := range []string{"GET /undocumented", "DELETE /healthz"} {
+		if !strings.Contains(err.Error(), route) {
+			t.Errorf("expected %q to name %s", err, route)
+		}
+	}
+}
+
+func TestDocsAreSelfContained(t *testing.T) {
+	s := newTestServer(t, DefaultOptions())
+
+	rec := httptest.NewRecorder()
+	s.router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/docs", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+
+	body := rec.Body.String()
+	for _, op := range []string{"GET /items", "POST /items/batch", "DELETE /items/{id}"} {
+		if !strings.Contains(body, op) {
+			t.Errorf("expected docs to describe %s", op)
+		}
+	}
+	for _, external := range []string{"<script", "<link", "https://"} {
+		if strings.Contains(body, external) {
+			t.Errorf("expected docs not to load anything, found %s", external)
+		}
+	}
+}
+
+func TestResponseValidationLeavesRequestsToHandlers(t *testing.T) {
+	opts := anonymousOptions()
+	opts.ValidateRequests = false
+	opts.ValidateResponses = true
+	s := newTestServer(t, opts)
+
+	req := httptest.NewRequest(http.MethodPost, "/items", strings.NewReader(`{"name":""}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	s.router().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), "validation_failed") {
+		t.Fatalf("expected 422 validation_failed, got %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestRequestValidationChecksTrimmedBodies(t *testing.T) {
+	s := newTestServer(t, anonymousOptions())
+
+	cases := []struct {
+		name        string
+		method      string
+		target      string
+		contentType string
+		body        string
+		status      int
+		code        string
+	}{
+		{"blank name", http.MethodPost, "/items", "application/json", `{"name":"   "}`, http.StatusUnprocessableEntity, "validation_failed"},
+		{"name trimmed", http.MethodPost, "/items", "application/json", `{"name":"\tbox\n"}`, http.StatusCreated, ""},
+		{"form", http.MethodPost, "/items", "application/x-www-form-urlencoded", "name=box&submit=save", http.StatusCreated, ""},
+		{"blank form name", http.MethodPost, "/items", "application/x-www-form-urlencoded", "name=+", http.StatusUnprocessableEntity, "validation_failed"},
+		{"wrong type", http.MethodPost, "/items", "application/json", `{"name":5}`, http.StatusBadRequest, "invalid_request"},
+		{"wrong shape", http.MethodPost, "/items", "application/json", `[{"name":"box"}]`, http.StatusBadRequest, "invalid_request"},
+		{"unknown field", http.MethodPost, "/items", "application/json", `{"name":"box","owner_id":"someone"}`, http.StatusBadRequest, "invalid_request"},
+		{"wrong item type", http.MethodPost, "/items/batch?mode=partial", "application/json", `[{"name":"box"},{"name":5}]`, http.StatusBadRequest, "invalid_request"},
+		{"invalid parameter", http.MethodGet, "/items?limit=0", "", "", http.StatusBadRequest, "invalid_request"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.target, strings.NewReader(tc.body))
+			if tc.contentType != "" {
+				req.Header.Set("Content-Type", tc.contentType)
+			}
+			rec := httptest.NewRecorder()
+			s.router().ServeHTTP(rec, req)
+
+			if rec.Code != tc.status || !strings.Contains(rec.Body.String(), tc.code) {
+				t.Fatalf("expected %d %s, got %d: %s", tc.status, tc.code, rec.Code, rec.Body)
+			}
+		})
+	}
+}
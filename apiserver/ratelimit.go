@@ -0,0 +1,345 @@
+package apiserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/geisonsn/go-and-compose/logging"
+	"github.com/geisonsn/go-and-compose/storage"
+	"github.com/gorilla/mux"
+)
+
+// rateLimitPruneInterval is how often keys back to a full burst are
+// forgotten.
+const rateLimitPruneInterval = time.Minute
+
+const rateLimitOff = "off"
+
+// RateLimit allows Requests per Period to a caller, in bursts of up to Burst
+// requests. The zero value doesn't limit anything.
+type RateLimit struct {
+	Requests int
+	Period   time.Duration
+	Burst    int
+}
+
+// ParseRateLimit parses limits written as REQUESTS/PERIOD[:BURST], such as
+// 10/s or 100/5m:20. The burst defaults to REQUESTS. "off", or an empty
+// string, is no limit.
+func ParseRateLimit(s string) (RateLimit, error) {
+	var l RateLimit
+	if s == "" || s == rateLimitOff {
+		return l, nil
+	}
+
+	spec, burst := s, ""
+	if i := strings.LastIndex(s, ":"); i >= 0 {
+		spec, burst = s[:i], s[i+1:]
+	}
+
+	parts := strings.SplitN(spec, "/", 2)
+	if len(parts) != 2 {
+		return l, fmt.Errorf("rate limit %q must look like REQUESTS/PERIOD[:BURST]", s)
+	}
+
+	var err error
+	if l.Requests, err = strconv.Atoi(parts[0]); err != nil || l.Requests < 1 {
+		return l, fmt.Errorf("rate limit %q must allow a positive number of requests", s)
+	}
+	period := parts[1]
+	if period != "" && (period[0] < '0' || period[0] > '9') {
+		period = "1" + period
+	}
+	if l.Period, err = time.ParseDuration(period); err != nil || l.Period <= 0 {
+		return l, fmt.Errorf("rate limit %q must have a positive period", s)
+	}
+
+	l.Burst = l.Requests
+	if burst != "" {
+		if l.Burst, err = strconv.Atoi(burst); err != nil || l.Burst < 1 {
+			return l, fmt.Errorf("rate limit %q must have a positive burst", s)
+		}
+	}
+
+	return l, nil
+}
+
+func (l RateLimit) String() string {
+	if !l.Enabled() {
+		return rateLimitOff
+	}
+
+	return fmt.Sprintf("%d/%s:%d", l.Requests, l.Period, l.Burst)
+}
+
+func (l RateLimit) Enabled() bool {
+	return l.Requests > 0
+}
+
+func (l RateLimit) validate() error {
+	if l.Requests < 0 || (l.Enabled() && (l.Period <= 0 || l.Burst < 1)) {
+		return fmt.Errorf("invalid rate limit %+v", l)
+	}
+
+	return nil
+}
+
+// interval is the cost of a single request.
+func (l RateLimit) interval() time.Duration {
+	return l.Period / time.Duration(l.Requests)
+}
+
+// tolerance is how far ahead of time a caller can be, a full burst.
+func (l RateLimit) tolerance() time.Duration {
+	return l.interval() * time.Duration(l.Burst)
+}
+
+// rateLimitStore counts requests per key. storage.Storage implements it for
+// limits shared between replicas, localRateLimits for a single one.
+type rateLimitStore interface {
+	TakeRateLimit(ctx context.Context, key string, interval, tolerance time.Duration) (*storage.RateLimitState, error)
+	PruneRateLimits(ctx context.Context) error
+}
+
+// dialectStore is implemented by stores backed by a SQL database.
+type dialectStore interface {
+	Dialect() string
+}
+
+// localRateLimits keeps the state of every key in process.
+type localRateLimits struct {
+	mu   sync.Mutex
+	tats map[string]time.Time
+}
+
+func newLocalRateLimits() *localRateLimits {
+	return &localRateLimits{tats: map[string]time.Time{}}
+}
+
+func (l *localRateLimits) TakeRateLimit(ctx context.Context, key string, interval, tolerance time.Duration) (*storage.RateLimitState, error) {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	tat := l.tats[key]
+	if tat.Before(now) {
+		tat = now
+	}
+
+	st := &storage.RateLimitState{TAT: tat, Now: now}
+	if next := tat.Add(interval); next.Sub(now) <= tolerance {
+		l.tats[key] = next
+		st.Allowed, st.TAT = true, next
+	}
+
+	return st, nil
+}
+
+func (l *localRateLimits) PruneRateLimits(ctx context.Context) error {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for key, tat := range l.tats {
+		if tat.Before(now) {
+			delete(l.tats, key)
+		}
+	}
+
+	return nil
+}
+
+// rateLimiter applies the default limit, or the one configured for the
+// route, to each caller, and the address limit to every client address.
+type rateLimiter struct {
+	store   rateLimitStore
+	limit   RateLimit
+	routes  map[string]RateLimit
+	address RateLimit
+
+	mu         sync.Mutex
+	lastPruned time.Time
+}
+
+func newRateLimiter(store ItemStore, opts Options) (*rateLimiter, error) {
+	rl := &rateLimiter{
+		store:      newLocalRateLimits(),
+		limit:      opts.RateLimit,
+		routes:     opts.RouteRateLimits,
+		address:    opts.IPRateLimit,
+		lastPruned: time.Now(),
+	}
+
+	if opts.SharedRateLimits {
+		shared, ok := store.(rateLimitStore)
+		if !ok {
+			return nil, errors.New("shared rate limits are not supported by this store")
+		}
+		if d, ok := store.(dialectStore); ok && d.Dialect() != storage.DialectPostgres {
+			return nil, fmt.Errorf("shared rate limits require a postgres database, not %s", d.Dialect())
+		}
+		rl.store = shared
+	}
+
+	return rl, nil
+}
+
+// middleware answers 429 to callers over their limit. It runs after
+// authentication so callers are told apart by their principal, and by their
+// address when authentication is disabled. Requests go through when the
+// limits can't be checked.
+func (rl *rateLimiter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		route, limit := rl.limitFor(req)
+		if rl.allow(w, req, route+" "+rateLimitKey(req), limit) {
+			next.ServeHTTP(w, req)
+		}
+	})
+}
+
+// addressMiddleware answers 429 to client addresses over the address limit.
+// It runs before authentication, so floods of requests with bad or missing
+// credentials are limited too and don't each reach the key store.
+func (rl *rateLimiter) addressMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if rl.allow(w, req, "address "+remoteIP(req), rl.address) {
+			next.ServeHTTP(w, req)
+		}
+	})
+}
+
+// allow counts the request against key and reports whether it can go on,
+// answering 429 itself when it can't.
+func (rl *rateLimiter) allow(w http.ResponseWriter, req *http.Request, key string, limit RateLimit) bool {
+	if !limit.Enabled() {
+		return true
+	}
+
+	st, err := rl.store.TakeRateLimit(req.Context(), key, limit.interval(), limit.tolerance())
+	if err != nil {
+		logging.FromContext(req.Context()).WithError(err).Error("could not check rate limit")
+		return true
+	}
+	rl.prune(req.Context())
+
+	remaining := int((limit.tolerance() - st.TAT.Sub(st.Now)) / limit.interval())
+	if remaining < 0 || !st.Allowed {
+		remaining = 0
+	}
+
+	h := w.Header()
+	h.Set("X-RateLimit-Limit", strconv.Itoa(limit.Burst))
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	h.Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(st.TAT.Sub(st.Now))))
+
+	if !st.Allowed {
+		retryAfter := st.TAT.Add(limit.interval()).Add(-limit.tolerance()).Sub(st.Now)
+		h.Set("Retry-After", strconv.Itoa(ceilSeconds(retryAfter)))
+		writeJSON(w, http.StatusTooManyRequests, errorEnvelope{Error: tooManyRequests(limit)})
+		return false
+	}
+
+	return true
+}
+
+// limitFor returns the route the request matched, as METHOD TEMPLATE, and
+// its limit.
+func (rl *rateLimiter) limitFor(req *http.Request) (string, RateLimit) {
+	route := req.Method + " " + req.URL.Path
+	if r := mux.CurrentRoute(req); r != nil {
+		if tpl, err := r.GetPathTemplate(); err == nil {
+			route = req.Method + " " + tpl
+		}
+	}
+
+	if l, ok := rl.routes[route]; ok {
+		return route, l
+	}
+
+	return route, rl.limit
+}
+
+// prune forgets idle keys every rateLimitPruneInterval, on the request that
+// happens to come after it.
+func (rl *rateLimiter) prune(ctx context.Context) {
+	rl.mu.Lock()
+	due := time.Since(rl.lastPruned) >= rateLimitPruneInterval
+	if due {
+		rl.lastPruned = time.Now()
+	}
+	rl.mu.Unlock()
+
+	if !due {
+		return
+	}
+
+	if err := rl.store.PruneRateLimits(ctx); err != nil {
+		logging.FromContext(ctx).WithError(err).Warn("could not prune rate limits")
+	}
+}
+
+func rateLimitKey(req *http.Request) string {
+	if p, ok := PrincipalFromContext(req.Context()); ok && p.Method != AuthMethodAnonymous {
+		return p.Method + ":" + p.ID
+	}
+
+	return "ip:" + remoteIP(req)
+}
+
+func remoteIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+
+	return host
+}
+
+// validateRateLimits checks the limits and that routes are written as METHOD
+// /path/template.
+func validateRateLimits(o Options) error {
+	if err := o.RateLimit.validate(); err != nil {
+		return err
+	}
+	if err := o.IPRateLimit.validate(); err != nil {
+		return fmt.Errorf("ip rate limit: %w", err)
+	}
+
+	for route, l := range o.RouteRateLimits {
+		parts := strings.SplitN(route, " ", 2)
+		if len(parts) != 2 || parts[0] != strings.ToUpper(parts[0]) || !strings.HasPrefix(parts[1], "/") {
+			return fmt.Errorf("rate limited route %q must look like METHOD /path", route)
+		}
+		if err := l.validate(); err != nil {
+			return fmt.Errorf("route %s: %w", route, err)
+		}
+	}
+
+	return nil
+}
+
+func tooManyRequests(l RateLimit) *APIError {
+	return &APIError{
+		Status:  http.StatusTooManyRequests,
+		Code:    "rate_limited",
+		Message: fmt.Sprintf("rate limit of %d requests per %s exceeded", l.Requests, l.Period),
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,213 @@
+// Package client is a Go client for the items API served by apiserver.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Options configures a Client.
+type Options struct {
+	// APIKey or BearerToken, a JWT, authenticates the requests. APIKey wins
+	// when both are set.
+	APIKey      string
+	BearerToken string
+
+	// Timeout bounds every attempt of a request. Zero means no timeout.
+	Timeout time.Duration
+	// MaxRetries is how many times a failed request is tried again. Requests
+	// are retried when rate limited and, unless they are POSTs, on network
+	// errors and 502, 503 and 504 responses.
+	MaxRetries int
+	// RetryBackoff is the wait before the first retry, doubled for each of
+	// the next ones. A Retry-After sent by the server takes precedence.
+	RetryBackoff time.Duration
+
+	// HTTPClient sends the requests, http.DefaultTransport is used when nil.
+	HTTPClient *http.Client
+	UserAgent  string
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Timeout:      time.Second * 30,
+		MaxRetries:   3,
+		RetryBackoff: time.Millisecond * 200,
+		UserAgent:    "go-and-compose-client",
+	}
+}
+
+// Client calls the API at a base URL. It is safe for concurrent use.
+type Client struct {
+	baseURL *url.URL
+	opts    Options
+	http    *http.Client
+}
+
+func New(baseURL string, opts Options) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("base url %q must be http or https", baseURL)
+	}
+	if opts.MaxRetries < 0 || opts.RetryBackoff < 0 || opts.Timeout < 0 {
+		return nil, errors.New("retries, backoff and timeout cannot be negative")
+	}
+
+	hc := &http.Client{Timeout: opts.Timeout}
+	if opts.HTTPClient != nil {
+		c := *opts.HTTPClient
+		if opts.Timeout > 0 {
+			c.Timeout = opts.Timeout
+		}
+		hc = &c
+	}
+
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	return &Client{baseURL: u, opts: opts, http: hc}, nil
+}
+
+// do sends a request, retrying it as configured, and decodes a successful
+// response into out, when given, or an error response into an *Error.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, in, out interface{}) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return fmt.Errorf("could not encode request: %w", err)
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		res, err := c.send(ctx, method, path, query, body)
+		if err == nil && res.StatusCode < http.StatusBadRequest {
+			defer res.Body.Close()
+			if out == nil || res.StatusCode == http.StatusNoContent {
+				return nil
+			}
+			if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+				return fmt.Errorf("could not decode response: %w", err)
+			}
+			return nil
+		}
+
+		if err == nil {
+			err = decodeError(res)
+		}
+
+		wait, retry := c.retryable(method, err, attempt)
+		if !retry {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, body []byte) (*http.Response, error) {
+	u := *c.baseURL
+	u.Path += path
+	u.RawQuery = query.Encode()
+
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), r)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.opts.UserAgent != "" {
+		req.Header.Set("User-Agent", c.opts.UserAgent)
+	}
+	switch {
+	case c.opts.APIKey != "":
+		req.Header.Set("X-API-Key", c.opts.APIKey)
+	case c.opts.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+c.opts.BearerToken)
+	}
+
+	return c.http.Do(req)
+}
+
+// retryable returns whether err, from the given attempt, is worth retrying
+// and how long to wait before doing so.
+func (c *Client) retryable(method string, err error, attempt int) (time.Duration, bool) {
+	if attempt >= c.opts.MaxRetries {
+		return 0, false
+	}
+
+	backoff := c.opts.RetryBackoff << uint(attempt)
+	if backoff > 0 {
+		backoff += time.Duration(rand.Int63n(int64(backoff)/2 + 1))
+	}
+
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		switch apiErr.Status {
+		case http.StatusTooManyRequests:
+			if apiErr.RetryAfter > 0 {
+				return apiErr.RetryAfter, true
+			}
+			return backoff, true
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return backoff, method != http.MethodPost
+		}
+
+		return 0, false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return backoff, method != http.MethodPost
+	}
+
+	return 0, false
+}
+
+func decodeError(res *http.Response) error {
+	defer res.Body.Close()
+
+	e := &Error{Status: res.StatusCode}
+	if s, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil {
+		e.RetryAfter = time.Duration(s) * time.Second
+	}
+
+	b, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1<<20))
+	var envelope struct {
+		Error *Error `json:"error"`
+	}
+	if err := json.Unmarshal(b, &envelope); err == nil && envelope.Error != nil {
+		e.Code = envelope.Error.Code
+		e.Message = envelope.Error.Message
+		e.Details = envelope.Error.Details
+	} else {
+		e.Message = strings.TrimSpace(string(b))
+	}
+
+	return e
+}
@@ -0,0 +1,214 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/geisonsn/go-and-compose/apiserver"
+	"github.com/geisonsn/go-and-compose/storage"
+)
+
+// testServer serves an APIServer backed by a memory store and counts the
+// requests it gets.
+type testServer struct {
+	*httptest.Server
+	requests int64
+}
+
+func newTestServer(t *testing.T, opts apiserver.Options) *testServer {
+	t.Helper()
+
+	s, err := apiserver.NewAPIServer(":0", storage.NewMemoryStorage(), opts)
+	if err != nil {
+		t.Fatalf("could not create server: %v", err)
+	}
+
+	ts := &testServer{}
+	handler := s.Handler()
+	ts.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt64(&ts.requests, 1)
+		handler.ServeHTTP(w, req)
+	}))
+	t.Cleanup(ts.Close)
+
+	return ts
+}
+
+// anonymousOptions are the default server options with authentication
+// turned off, so the tests don't need an API key.
+func anonymousOptions() apiserver.Options {
+	opts := apiserver.DefaultOptions()
+	opts.AuthEnabled = false
+
+	return opts
+}
+
+func (ts *testServer) client(t *testing.T, opts Options) *Client {
+	t.Helper()
+
+	c, err := New(ts.URL, opts)
+	if err != nil {
+		t.Fatalf("could not create client: %v", err)
+	}
+
+	return c
+}
+
+func TestItemsCRUD(t *testing.T) {
+	ctx := context.Background()
+	c := newTestServer(t, anonymousOptions()).client(t, DefaultOptions())
+
+	created, err := c.CreateItem(ctx, CreateItemRequest{Name: "box"})
+	if err != nil {
+		t.Fatalf("could not create item: %v", err)
+	}
+	if created.ID == "" || created.Name != "box" {
+		t.Fatalf("unexpected created item %+v", created)
+	}
+
+	got, err := c.GetItem(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("could not get item: %v", err)
+	}
+	if got.ID != created.ID || got.Name != "box" {
+		t.Fatalf("expected %+v, got %+v", created, got)
+	}
+
+	replaced, err := c.ReplaceItem(ctx, created.ID, CreateItemRequest{Name: "crate"})
+	if err != nil {
+		t.Fatalf("could not replace item: %v", err)
+	}
+	if replaced.Name != "crate" {
+		t.Fatalf("expected the name to be replaced, got %q", replaced.Name)
+	}
+
+	name := "chest"
+	updated, err := c.UpdateItem(ctx, created.ID, UpdateItemRequest{Name: &name})
+	if err != nil {
+		t.Fatalf("could not update item: %v", err)
+	}
+	if updated.Name != name {
+		t.Fatalf("expected the name to be updated, got %q", updated.Name)
+	}
+
+	if err := c.DeleteItem(ctx, created.ID); err != nil {
+		t.Fatalf("could not delete item: %v", err)
+	}
+
+	_, err = c.GetItem(ctx, created.ID)
+	if !IsNotFound(err) {
+		t.Fatalf("expected a not found error after delete, got %v", err)
+	}
+}
+
+func TestItemsIteratesOverPages(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestServer(t, anonymousOptions())
+	c := ts.client(t, DefaultOptions())
+
+	for i := 0; i < 5; i++ {
+		if _, err := c.CreateItem(ctx, CreateItemRequest{Name: fmt.Sprintf("item %d", i)}); err != nil {
+			t.Fatalf("could not create item: %v", err)
+		}
+	}
+
+	before := atomic.LoadInt64(&ts.requests)
+	it := c.Items(ListItemsQuery{Limit: 2, Sort: "name"})
+	var names []string
+	for it.Next(ctx) {
+		names = append(names, it.Item().Name)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("could not iterate: %v", err)
+	}
+
+	if len(names) != 5 || names[0] != "item 0" || names[4] != "item 4" {
+		t.Fatalf("expected the 5 items in order, got %v", names)
+	}
+	if pages := atomic.LoadInt64(&ts.requests) - before; pages != 3 {
+		t.Fatalf("expected 3 pages to be fetched, got %d", pages)
+	}
+}
+
+func TestErrorsAreDecoded(t *testing.T) {
+	ctx := context.Background()
+	c := newTestServer(t, anonymousOptions()).client(t, DefaultOptions())
+
+	_, err := c.GetItem(ctx, "missing")
+	if !IsNotFound(err) {
+		t.Fatalf("expected a not found error, got %v", err)
+	}
+
+	_, err = c.CreateItem(ctx, CreateItemRequest{Name: "  "})
+	if !IsInvalid(err) {
+		t.Fatalf("expected an invalid error, got %v", err)
+	}
+
+	e := err.(*Error)
+	if e.Status != http.StatusUnprocessableEntity || e.Code != "validation_failed" {
+		t.Fatalf("expected a 422 validation_failed, got %d %s", e.Status, e.Code)
+	}
+	if len(e.Details) == 0 || e.Details[0].Field != "name" {
+		t.Fatalf("expected details about the name, got %+v", e.Details)
+	}
+}
+
+func TestRateLimitedRequestsAreRetriedAfterRetryAfter(t *testing.T) {
+	ctx := context.Background()
+
+	opts := anonymousOptions()
+	opts.RateLimit = apiserver.RateLimit{Requests: 1, Period: time.Second, Burst: 1}
+	ts := newTestServer(t, opts)
+
+	copts := DefaultOptions()
+	copts.RetryBackoff = time.Millisecond
+	c := ts.client(t, copts)
+
+	if _, err := c.ListItems(ctx, ListItemsQuery{}); err != nil {
+		t.Fatalf("could not list items: %v", err)
+	}
+
+	before := atomic.LoadInt64(&ts.requests)
+	start := time.Now()
+	if _, err := c.ListItems(ctx, ListItemsQuery{}); err != nil {
+		t.Fatalf("expected the rate limited request to be retried, got %v", err)
+	}
+
+	// The server asks for a second, the backoff alone would be a millisecond.
+	if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+		t.Fatalf("expected the retry to wait for Retry-After, it came after %s", elapsed)
+	}
+	if attempts := atomic.LoadInt64(&ts.requests) - before; attempts != 2 {
+		t.Fatalf("expected 2 attempts, got %d", attempts)
+	}
+}
+
+func TestRateLimitedRequestsFailOnceRetriesRunOut(t *testing.T) {
+	ctx := context.Background()
+
+	opts := anonymousOptions()
+	opts.RateLimit = apiserver.RateLimit{Requests: 1, Period: time.Minute, Burst: 1}
+	ts := newTestServer(t, opts)
+
+	copts := DefaultOptions()
+	copts.MaxRetries = 0
+	c := ts.client(t, copts)
+
+	if _, err := c.ListItems(ctx, ListItemsQuery{}); err != nil {
+		t.Fatalf("could not list items: %v", err)
+	}
+
+	_, err := c.ListItems(ctx, ListItemsQuery{})
+	e, ok := err.(*Error)
+	if !ok || e.Status != http.StatusTooManyRequests {
+		t.Fatalf("expected a 429, got %v", err)
+	}
+	if e.RetryAfter <= 0 {
+		t.Fatalf("expected Retry-After to be decoded, got %s", e.RetryAfter)
+	}
+}
@@ -0,0 +1,173 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+type Item struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	OwnerID   string    `json:"owner_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type CreateItemRequest struct {
+	Name string `json:"name"`
+}
+
+// UpdateItemRequest changes the fields that are set.
+type UpdateItemRequest struct {
+	Name *string `json:"name,omitempty"`
+}
+
+// ListItemsQuery selects a page of items, its zero value the first page
+// with the server defaults.
+type ListItemsQuery struct {
+	Limit        int
+	Cursor       string
+	Sort         string
+	Order        string
+	NamePrefix   string
+	NameContains string
+	// OwnerID is only allowed to admins, for the items of other owners.
+	OwnerID string
+}
+
+type ItemPage struct {
+	Items      []*Item `json:"items"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+func (q ListItemsQuery) values() url.Values {
+	v := url.Values{}
+	set := func(k, s string) {
+		if s != "" {
+			v.Set(k, s)
+		}
+	}
+
+	if q.Limit > 0 {
+		v.Set("limit", strconv.Itoa(q.Limit))
+	}
+	set("cursor", q.Cursor)
+	set("sort", q.Sort)
+	set("order", q.Order)
+	set("name_prefix", q.NamePrefix)
+	set("name_contains", q.NameContains)
+	set("owner_id", q.OwnerID)
+
+	return v
+}
+
+func (c *Client) CreateItem(ctx context.Context, r CreateItemRequest) (*Item, error) {
+	item := &Item{}
+	if err := c.do(ctx, http.MethodPost, "/items", nil, r, item); err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+func (c *Client) GetItem(ctx context.Context, id string) (*Item, error) {
+	item := &Item{}
+	if err := c.do(ctx, http.MethodGet, "/items/"+url.PathEscape(id), nil, nil, item); err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// ReplaceItem sets every field of the item.
+func (c *Client) ReplaceItem(ctx context.Context, id string, r CreateItemRequest) (*Item, error) {
+	item := &Item{}
+	if err := c.do(ctx, http.MethodPut, "/items/"+url.PathEscape(id), nil, r, item); err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// UpdateItem sets the fields of the item present in r.
+func (c *Client) UpdateItem(ctx context.Context, id string, r UpdateItemRequest) (*Item, error) {
+	item := &Item{}
+	if err := c.do(ctx, http.MethodPatch, "/items/"+url.PathEscape(id), nil, r, item); err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+func (c *Client) DeleteItem(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/items/"+url.PathEscape(id), nil, nil, nil)
+}
+
+// ListItems returns a single page, see Items to go through all of them.
+func (c *Client) ListItems(ctx context.Context, q ListItemsQuery) (*ItemPage, error) {
+	page := &ItemPage{}
+	if err := c.do(ctx, http.MethodGet, "/items", q.values(), nil, page); err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// Items iterates over every item matching q, fetching pages as needed:
+//
+//	it := c.Items(q)
+//	for it.Next(ctx) {
+//		item := it.Item()
+//	}
+//	if err := it.Err(); err != nil {
+//	}
+func (c *Client) Items(q ListItemsQuery) *ItemIterator {
+	return &ItemIterator{client: c, query: q}
+}
+
+// ItemIterator goes through the pages of a listing. It isn't safe for
+// concurrent use.
+type ItemIterator struct {
+	client *Client
+	query  ListItemsQuery
+	page   []*Item
+	item   *Item
+	done   bool
+	err    error
+}
+
+// Next advances to the next item, returning false once there are no more or
+// a page could not be fetched.
+func (it *ItemIterator) Next(ctx context.Context) bool {
+	for len(it.page) == 0 {
+		if it.done || it.err != nil {
+			return false
+		}
+
+		page, err := it.client.ListItems(ctx, it.query)
+		if err != nil {
+			it.err = err
+			return false
+		}
+
+		it.page = page.Items
+		it.query.Cursor = page.NextCursor
+		it.done = page.NextCursor == ""
+	}
+
+	it.item, it.page = it.page[0], it.page[1:]
+	return true
+}
+
+// Item is the current item, valid after Next returned true.
+func (it *ItemIterator) Item() *Item {
+	return it.item
+}
+
+// Err is the error that stopped the iteration, if any.
+func (it *ItemIterator) Err() error {
+	return it.err
+}
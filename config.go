@@ -0,0 +1,206 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/geisonsn/go-and-compose/storage"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+	"github.com/urfave/cli/v2/altsrc"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	configFlagName string = "config"
+
+	logFormatText string = "text"
+	logFormatJSON string = "json"
+)
+
+// secretFlags are never printed as is by `config print`. URLs only have
+// their password hidden.
+var secretFlags = map[string]func(string) string{
+	apiServerStorageDatabaseURL: storage.RedactURL,
+	jwtHMACSecretFlagName:       redacted,
+}
+
+func redacted(string) string {
+	return "REDACTED"
+}
+
+func configCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "config",
+		Usage: "inspects the configuration the start command would use",
+		Subcommands: []*cli.Command{
+			configSubcommand("validate", "checks the merged configuration is valid", func(c *cli.Context) error {
+				if err := validateConfig(c); err != nil {
+					return err
+				}
+
+				fmt.Fprintln(c.App.Writer, "configuration is valid")
+				return nil
+			}),
+			configSubcommand("print", "prints the merged configuration with secrets redacted", func(c *cli.Context) error {
+				out, err := yaml.Marshal(effectiveConfig(c, serverFlags()))
+				if err != nil {
+					return err
+				}
+
+				_, err = c.App.Writer.Write(out)
+				return err
+			}),
+		},
+	}
+}
+
+// configSubcommand builds a command accepting exactly the flags of start, so
+// the configuration is merged the same way.
+func configSubcommand(name, usage string, action cli.ActionFunc) *cli.Command {
+	flags := configurable(serverFlags())
+
+	return &cli.Command{
+		Name:   name,
+		Usage:  usage,
+		Flags:  withConfigFlag(flags),
+		Before: loadConfigFile(flags),
+		Action: action,
+	}
+}
+
+func withConfigFlag(flags []cli.Flag) []cli.Flag {
+	return append([]cli.Flag{
+		&cli.PathFlag{Name: configFlagName, EnvVars: []string{"API_SERVER_CONFIG"}, Usage: "YAML or TOML file, keys are flag names"},
+	}, flags...)
+}
+
+// loadConfigFile sets every flag in flags, which must have been wrapped by
+// configurable, that wasn't given on the command line or
+// through its env var from the --config file, if there is one. Precedence is
+// flag, then env var, then file, then the flag default.
+func loadConfigFile(flags []cli.Flag) cli.BeforeFunc {
+	return func(c *cli.Context) error {
+		path := c.Path(configFlagName)
+		if path == "" {
+			return nil
+		}
+
+		var (
+			src altsrc.InputSourceContext
+			err error
+		)
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".toml":
+			src, err = altsrc.NewTomlSourceFromFile(path)
+		case ".yaml", ".yml":
+			src, err = altsrc.NewYamlSourceFromFile(path)
+		default:
+			return fmt.Errorf("config file %s must be .yaml, .yml or .toml", path)
+		}
+		if err != nil {
+			return fmt.Errorf("could not load config file: %w", err)
+		}
+
+		return altsrc.ApplyInputSourceValues(c, src, flags)
+	}
+}
+
+// configurable wraps flags so altsrc can fill them in from a config file.
+func configurable(flags []cli.Flag) []cli.Flag {
+	wrapped := make([]cli.Flag, 0, len(flags))
+	for _, f := range flags {
+		switch f := f.(type) {
+		case *cli.StringFlag:
+			wrapped = append(wrapped, altsrc.NewStringFlag(f))
+		case *cli.IntFlag:
+			wrapped = append(wrapped, altsrc.NewIntFlag(f))
+		case *cli.BoolFlag:
+			wrapped = append(wrapped, altsrc.NewBoolFlag(f))
+		case *cli.DurationFlag:
+			wrapped = append(wrapped, altsrc.NewDurationFlag(f))
+		case *cli.StringSliceFlag:
+			wrapped = append(wrapped, altsrc.NewStringSliceFlag(f))
+		case *cli.PathFlag:
+			wrapped = append(wrapped, altsrc.NewPathFlag(f))
+		}
+	}
+
+	return wrapped
+}
+
+// effectiveConfig returns the value of every flag, in declaration order, as
+// the start command would see it.
+func effectiveConfig(c *cli.Context, flags []cli.Flag) yaml.MapSlice {
+	cfg := make(yaml.MapSlice, 0, len(flags))
+	for _, f := range flags {
+		name := f.Names()[0]
+
+		var value interface{} = c.Value(name)
+		switch v := value.(type) {
+		case time.Duration:
+			value = v.String()
+		case cli.StringSlice:
+			value = v.Value()
+		}
+
+		if redact, ok := secretFlags[name]; ok {
+			if s, ok := value.(string); ok && s != "" {
+				value = redact(s)
+			}
+		}
+
+		cfg = append(cfg, yaml.MapItem{Key: name, Value: value})
+	}
+
+	return cfg
+}
+
+func validateConfig(c *cli.Context) error {
+	var errs []string
+	if c.String(apiServerAddrFlagName) == "" {
+		errs = append(errs, "addr is required")
+	}
+	if c.String(apiServerStorageDatabaseURL) == "" {
+		errs = append(errs, "database-url is required")
+	}
+	if opts, err := serverOptions(c); err != nil {
+		errs = append(errs, err.Error())
+	} else if err := opts.Validate(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if _, err := logrus.ParseLevel(c.String(logLevelFlagName)); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if f := c.String(logFormatFlagName); f != logFormatText && f != logFormatJSON {
+		errs = append(errs, fmt.Sprintf("log-format must be %s or %s", logFormatText, logFormatJSON))
+	}
+
+	if len(errs) > 0 {
+		return errors.New("invalid configuration: " + strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+func configureLogging(c *cli.Context) error {
+	level, err := logrus.ParseLevel(c.String(logLevelFlagName))
+	if err != nil {
+		return err
+	}
+	logrus.SetLevel(level)
+
+	switch f := c.String(logFormatFlagName); f {
+	case logFormatText:
+		logrus.SetFormatter(&logrus.TextFormatter{})
+	case logFormatJSON:
+		logrus.SetFormatter(&logrus.JSONFormatter{})
+	default:
+		return fmt.Errorf("unknown log format %q", f)
+	}
+
+	return nil
+}
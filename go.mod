@@ -3,8 +3,14 @@ module github.com/geisonsn/go-and-compose
 go 1.16
 
 require (
+	github.com/getkin/kin-openapi v0.98.0
+	github.com/golang-jwt/jwt/v4 v4.4.2
 	github.com/gorilla/mux v1.8.0
 	github.com/lib/pq v1.10.6
+	github.com/prometheus/client_golang v1.12.2
 	github.com/sirupsen/logrus v1.9.0
 	github.com/urfave/cli/v2 v2.11.0
+	golang.org/x/net v0.0.0-20220722155237-a158d28d115b
+	gopkg.in/yaml.v2 v2.4.0
+	modernc.org/sqlite v1.18.0
 )
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/geisonsn/go-and-compose/apiserver"
+	"github.com/geisonsn/go-and-compose/client"
+	"github.com/geisonsn/go-and-compose/storage"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	outputTable string = "table"
+	outputJSON  string = "json"
+	outputCSV   string = "csv"
+)
+
+var itemCSVHeader = []string{"id", "name", "owner_id", "created_at", "updated_at"}
+
+// itemService is what the items commands need, from the database or from a
+// running server.
+type itemService interface {
+	CreateItem(ctx context.Context, i storage.CreateItemRequest) (*storage.Item, error)
+	GetItem(ctx context.Context, id string) (*storage.Item, error)
+	DeleteItem(ctx context.Context, id string) error
+	ListItems(ctx context.Context, q storage.ListItemsQuery) (*storage.ItemPage, error)
+	Close() error
+}
+
+func itemsCmd() *cli.Command {
+	flags := []cli.Flag{
+		&cli.StringFlag{Name: apiServerStorageDatabaseURL, EnvVars: []string{"DATABASE_URL"}},
+		&cli.StringFlag{Name: endpointFlagName, EnvVars: []string{"API_SERVER_ENDPOINT"}, Usage: "URL of a running server to use instead of the database"},
+		&cli.StringFlag{Name: apiKeyFlagName, EnvVars: []string{"API_KEY"}, Usage: "API key for --endpoint"},
+		&cli.StringFlag{Name: tokenFlagName, EnvVars: []string{"API_TOKEN"}, Usage: "bearer token for --endpoint"},
+		&cli.StringFlag{Name: ownerFlagName, Usage: "owner of the items created, or listed, in the database, as api_key:OWNER, jwt:SUBJECT or anonymous; with --endpoint items are created for the caller"},
+		&cli.StringFlag{Name: outputFlagName, Aliases: []string{"o"}, Value: outputTable, Usage: "table, json or csv"},
+	}
+	filterFlags := append([]cli.Flag{
+		&cli.IntFlag{Name: limitFlagName, Usage: "page size, the server default when 0"},
+		&cli.StringFlag{Name: sortFlagName, Usage: "id, name or created_at"},
+		&cli.StringFlag{Name: orderFlagName, Usage: "asc or desc"},
+		&cli.StringFlag{Name: namePrefixFlagName},
+		&cli.StringFlag{Name: nameContainsFlagName},
+	}, flags...)
+
+	return &cli.Command{
+		Name:  "items",
+		Usage: "manages items in the database or through a running server",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "create",
+				Usage:     "creates an item",
+				ArgsUsage: "NAME",
+				Flags:     flags,
+				Before:    requireOwner,
+				Action: withItems(func(c *cli.Context, items itemService) error {
+					item, err := createItem(c, items, strings.Join(c.Args().Slice(), " "))
+					if err != nil {
+						return err
+					}
+
+					return writeItems(c, []*storage.Item{item}, true)
+				}),
+			},
+			{
+				Name:  "list",
+				Usage: "lists a page of items, or all of them with --all",
+				Flags: append([]cli.Flag{
+					&cli.StringFlag{Name: cursorFlagName, Usage: "next cursor printed by a previous list"},
+					&cli.BoolFlag{Name: allFlagName, Usage: "lists every page"},
+				}, filterFlags...),
+				Action: withItems(func(c *cli.Context, items itemService) error {
+					list, next, err := listItems(c, items, c.Bool(allFlagName))
+					if err != nil {
+						return err
+					}
+
+					if err := writeItems(c, list, false); err != nil {
+						return err
+					}
+					if next != "" {
+						fmt.Fprintf(c.App.ErrWriter, "next cursor: %s\n", next)
+					}
+
+					return nil
+				}),
+			},
+			{
+				Name:      "get",
+				Usage:     "shows an item",
+				ArgsUsage: "ID",
+				Flags:     flags,
+				Action: withItems(func(c *cli.Context, items itemService) error {
+					if c.NArg() != 1 {
+						return fmt.Errorf("expected an item id, got %d arguments", c.NArg())
+					}
+
+					item, err := items.GetItem(c.Context, c.Args().First())
+					if err != nil {
+						return err
+					}
+
+					return writeItems(c, []*storage.Item{item}, true)
+				}),
+			},
+			{
+				Name:      "delete",
+				Usage:     "deletes items",
+				ArgsUsage: "ID...",
+				Flags:     flags,
+				Action: withItems(func(c *cli.Context, items itemService) error {
+					if !c.Args().Present() {
+						return errors.New("expected at least an item id")
+					}
+
+					for _, id := range c.Args().Slice() {
+						if err := items.DeleteItem(c.Context, id); err != nil {
+							return err
+						}
+						fmt.Fprintf(c.App.Writer, "deleted %s\n", id)
+					}
+
+					return nil
+				}),
+			},
+			{
+				Name:      "import",
+				Usage:     "creates the items of a JSON array or of a CSV file with a name column",
+				ArgsUsage: "FILE|-",
+				Flags: append([]cli.Flag{
+					&cli.StringFlag{Name: formatFlagName, Usage: "json or csv, from the file extension by default"},
+				}, flags...),
+				Before: requireOwner,
+				Action: withItems(func(c *cli.Context, items itemService) error {
+					names, err := readItemNames(c)
+					if err != nil {
+						return err
+					}
+
+					created := make([]*storage.Item, 0, len(names))
+					for i, name := range names {
+						item, err := createItem(c, items, name)
+						if err != nil {
+							if len(created) > 0 {
+								writeItems(c, created, false)
+							}
+							return fmt.Errorf("item %d (%q): %w", i+1, name, err)
+						}
+						created = append(created, item)
+					}
+
+					return writeItems(c, created, false)
+				}),
+			},
+			{
+				Name:  "export",
+				Usage: "writes every item, as JSON by default",
+				Flags: filterFlags,
+				Before: func(c *cli.Context) error {
+					if !c.IsSet(outputFlagName) {
+						return c.Set(outputFlagName, outputJSON)
+					}
+					return nil
+				},
+				Action: withItems(func(c *cli.Context, items itemService) error {
+					list, _, err := listItems(c, items, true)
+					if err != nil {
+						return err
+					}
+
+					return writeItems(c, list, false)
+				}),
+			},
+		},
+	}
+}
+
+// withItems opens the item service selected by the flags for action and
+// closes it afterwards.
+func withItems(action func(*cli.Context, itemService) error) cli.ActionFunc {
+	return func(c *cli.Context) error {
+		switch o := c.String(outputFlagName); o {
+		case outputTable, outputJSON, outputCSV:
+		default:
+			return fmt.Errorf("output must be %s, %s or %s, got %q", outputTable, outputJSON, outputCSV, o)
+		}
+
+		items, err := openItems(c)
+		if err != nil {
+			return err
+		}
+		defer items.Close()
+
+		return action(c, items)
+	}
+}
+
+func openItems(c *cli.Context) (itemService, error) {
+	endpoint := c.String(endpointFlagName)
+	if endpoint == "" {
+		return openStorage(c)
+	}
+
+	opts := client.DefaultOptions()
+	opts.APIKey = c.String(apiKeyFlagName)
+	opts.BearerToken = c.String(tokenFlagName)
+	cl, err := client.New(endpoint, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &remoteItems{client: cl}, nil
+}
+
+// requireOwner checks items created in the database get an owner the API
+// knows, without one they would only be visible to admins.
+func requireOwner(c *cli.Context) error {
+	if c.String(endpointFlagName) != "" {
+		return nil
+	}
+
+	owner := c.String(ownerFlagName)
+	if owner == "" {
+		return fmt.Errorf("--%s is required to create items in the database", ownerFlagName)
+	}
+	if owner != apiserver.AuthMethodAnonymous &&
+		!strings.HasPrefix(owner, apiserver.AuthMethodAPIKey+":") &&
+		!strings.HasPrefix(owner, apiserver.AuthMethodJWT+":") {
+		return fmt.Errorf("--%s must be %s:OWNER, %s:SUBJECT or %s, got %q", ownerFlagName, apiserver.AuthMethodAPIKey, apiserver.AuthMethodJWT, apiserver.AuthMethodAnonymous, owner)
+	}
+
+	return nil
+}
+
+func createItem(c *cli.Context, items itemService, name string) (*storage.Item, error) {
+	r := storage.CreateItemRequest{Name: name, OwnerID: c.String(ownerFlagName)}
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+
+	return items.CreateItem(c.Context, r)
+}
+
+// listItems returns a page of items, or every page when all is set, and the
+// cursor of the next page, if there is one.
+func listItems(c *cli.Context, items itemService, all bool) ([]*storage.Item, string, error) {
+	q := storage.ListItemsQuery{
+		Limit:        c.Int(limitFlagName),
+		Cursor:       c.String(cursorFlagName),
+		Sort:         c.String(sortFlagName),
+		Direction:    c.String(orderFlagName),
+		NamePrefix:   c.String(namePrefixFlagName),
+		NameContains: c.String(nameContainsFlagName),
+		OwnerID:      c.String(ownerFlagName),
+	}
+
+	var list []*storage.Item
+	for {
+		page, err := items.ListItems(c.Context, q)
+		if err != nil {
+			return nil, "", err
+		}
+
+		list = append(list, page.Items...)
+		if !all || page.NextCursor == "" {
+			return list, page.NextCursor, nil
+		}
+		q.Cursor = page.NextCursor
+	}
+}
+
+// writeItems prints items in the --output format. single prints a JSON
+// object instead of an array.
+func writeItems(c *cli.Context, items []*storage.Item, single bool) error {
+	w := c.App.Writer
+
+	switch c.String(outputFlagName) {
+	case outputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if single && len(items) == 1 {
+			return enc.Encode(items[0])
+		}
+		if items == nil {
+			items = []*storage.Item{}
+		}
+		return enc.Encode(items)
+	case outputCSV:
+		cw := csv.NewWriter(w)
+		cw.Write(itemCSVHeader)
+		for _, i := range items {
+			cw.Write([]string{i.ID, i.Name, i.OwnerID, i.CreatedAt.Format(time.RFC3339Nano), i.UpdatedAt.Format(time.RFC3339Nano)})
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tNAME\tOWNER\tCREATED AT\tUPDATED AT")
+		for _, i := range items {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", i.ID, i.Name, i.OwnerID, i.CreatedAt.Format(time.RFC3339), i.UpdatedAt.Format(time.RFC3339))
+		}
+		return tw.Flush()
+	}
+}
+
+// readItemNames reads the names to import from the file argument, - being
+// stdin. JSON files are an array of objects with a name, CSV files need a
+// header with a name column, as written by export.
+func readItemNames(c *cli.Context) ([]string, error) {
+	if c.NArg() != 1 {
+		return nil, fmt.Errorf("expected a file, got %d arguments", c.NArg())
+	}
+
+	path := c.Args().First()
+	format := c.String(formatFlagName)
+	if format == "" {
+		format = strings.TrimPrefix(filepath.Ext(path), ".")
+	}
+
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	switch format {
+	case outputJSON:
+		var reqs []storage.CreateItemRequest
+		if err := json.NewDecoder(r).Decode(&reqs); err != nil {
+			return nil, fmt.Errorf("could not decode %s: %w", path, err)
+		}
+
+		names := make([]string, 0, len(reqs))
+		for _, req := range reqs {
+			names = append(names, req.Name)
+		}
+		return names, nil
+	case outputCSV:
+		records, err := csv.NewReader(r).ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("could not read %s: %w", path, err)
+		}
+		if len(records) == 0 {
+			return nil, nil
+		}
+
+		col := -1
+		for i, h := range records[0] {
+			if strings.TrimSpace(h) == "name" {
+				col = i
+			}
+		}
+		if col < 0 {
+			return nil, fmt.Errorf("%s has no name column", path)
+		}
+
+		names := make([]string, 0, len(records)-1)
+		for _, rec := range records[1:] {
+			names = append(names, rec[col])
+		}
+		return names, nil
+	}
+
+	return nil, fmt.Errorf("unknown import format %q, use --%s json or csv", format, formatFlagName)
+}
+
+// remoteItems implements itemService with the API of a running server.
+type remoteItems struct {
+	client *client.Client
+}
+
+func (r *remoteItems) CreateItem(ctx context.Context, i storage.CreateItemRequest) (*storage.Item, error) {
+	item, err := r.client.CreateItem(ctx, client.CreateItemRequest{Name: i.Name})
+	if err != nil {
+		return nil, err
+	}
+
+	return fromClientItem(item), nil
+}
+
+func (r *remoteItems) GetItem(ctx context.Context, id string) (*storage.Item, error) {
+	item, err := r.client.GetItem(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return fromClientItem(item), nil
+}
+
+func (r *remoteItems) DeleteItem(ctx context.Context, id string) error {
+	return r.client.DeleteItem(ctx, id)
+}
+
+func (r *remoteItems) ListItems(ctx context.Context, q storage.ListItemsQuery) (*storage.ItemPage, error) {
+	page, err := r.client.ListItems(ctx, client.ListItemsQuery{
+		Limit:        q.Limit,
+		Cursor:       q.Cursor,
+		Sort:         q.Sort,
+		Order:        q.Direction,
+		NamePrefix:   q.NamePrefix,
+		NameContains: q.NameContains,
+		OwnerID:      q.OwnerID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*storage.Item, 0, len(page.Items))
+	for _, i := range page.Items {
+		items = append(items, fromClientItem(i))
+	}
+
+	return &storage.ItemPage{Items: items, NextCursor: page.NextCursor}, nil
+}
+
+func (r *remoteItems) Close() error {
+	return nil
+}
+
+func fromClientItem(i *client.Item) *storage.Item {
+	return &storage.Item{ID: i.ID, Name: i.Name, OwnerID: i.OwnerID, CreatedAt: i.CreatedAt, UpdatedAt: i.UpdatedAt}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/geisonsn/go-and-compose/apiserver"
+	"github.com/geisonsn/go-and-compose/storage"
+	"github.com/urfave/cli/v2"
+)
+
+func keysCmd() *cli.Command {
+	databaseURLFlag := &cli.StringFlag{Name: apiServerStorageDatabaseURL, EnvVars: []string{"DATABASE_URL"}}
+
+	return &cli.Command{
+		Name:  "keys",
+		Usage: "manages the API keys accepted by the server",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "create",
+				Usage:     "creates a key and prints it, it can't be retrieved later",
+				ArgsUsage: "NAME",
+				Flags: []cli.Flag{
+					databaseURLFlag,
+					&cli.StringFlag{Name: keyRoleFlagName, Value: string(storage.RoleWriter), Usage: "reader, writer or admin"},
+					&cli.StringFlag{Name: ownerFlagName, Usage: "owner of the items created with the key, shared by its other keys; the key id by default"},
+				},
+				Action: func(c *cli.Context) error {
+					s, err := openStorage(c)
+					if err != nil {
+						return err
+					}
+					defer s.Close()
+
+					k, key, err := s.CreateAPIKey(c.Context, storage.CreateAPIKeyRequest{
+						Name:  strings.Join(c.Args().Slice(), " "),
+						Role:  storage.Role(c.String(keyRoleFlagName)),
+						Owner: c.String(ownerFlagName),
+					})
+					if err != nil {
+						return err
+					}
+
+					fmt.Fprintf(c.App.Writer, "id:    %s\nowner: %s:%s\nkey:   %s\n", k.ID, apiserver.AuthMethodAPIKey, k.Owner, key)
+					return nil
+				},
+			},
+			{
+				Name:      "revoke",
+				Usage:     "revokes a key, requests using it are rejected from then on",
+				ArgsUsage: "ID",
+				Flags:     []cli.Flag{databaseURLFlag},
+				Action: func(c *cli.Context) error {
+					if c.NArg() != 1 {
+						return fmt.Errorf("expected a key id, got %d arguments", c.NArg())
+					}
+
+					s, err := openStorage(c)
+					if err != nil {
+						return err
+					}
+					defer s.Close()
+
+					if err := s.RevokeAPIKey(c.Context, c.Args().First()); err != nil {
+						return err
+					}
+
+					fmt.Fprintf(c.App.Writer, "revoked %s\n", c.Args().First())
+					return nil
+				},
+			},
+			{
+				Name:  "list",
+				Usage: "lists the keys, without their secret part",
+				Flags: []cli.Flag{databaseURLFlag},
+				Action: func(c *cli.Context) error {
+					s, err := openStorage(c)
+					if err != nil {
+						return err
+					}
+					defer s.Close()
+
+					keys, err := s.ListAPIKeys(c.Context)
+					if err != nil {
+						return err
+					}
+
+					w := tabwriter.NewWriter(c.App.Writer, 0, 4, 2, ' ', 0)
+					fmt.Fprintln(w, "ID\tNAME\tPREFIX\tROLE\tOWNER\tCREATED AT\tREVOKED AT")
+					for _, k := range keys {
+						revokedAt := "-"
+						if k.RevokedAt != nil {
+							revokedAt = k.RevokedAt.Format(time.RFC3339)
+						}
+						fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", k.ID, k.Name, k.Prefix, k.Role, k.Owner, k.CreatedAt.Format(time.RFC3339), revokedAt)
+					}
+
+					return w.Flush()
+				},
+			},
+		},
+	}
+}
@@ -1,10 +1,15 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
+	"text/tabwriter"
+	"time"
 
 	"github.com/geisonsn/go-and-compose/apiserver"
 	"github.com/geisonsn/go-and-compose/storage"
@@ -15,6 +20,66 @@ import (
 const (
 	apiServerAddrFlagName       string = "addr"
 	apiServerStorageDatabaseURL string = "database-url"
+	migrateDirFlagName          string = "dir"
+	keyRoleFlagName             string = "role"
+
+	endpointFlagName     string = "endpoint"
+	apiKeyFlagName       string = "api-key"
+	tokenFlagName        string = "token"
+	ownerFlagName        string = "owner"
+	outputFlagName       string = "output"
+	formatFlagName       string = "format"
+	limitFlagName        string = "limit"
+	sortFlagName         string = "sort"
+	orderFlagName        string = "order"
+	namePrefixFlagName   string = "name-prefix"
+	nameContainsFlagName string = "name-contains"
+	cursorFlagName       string = "cursor"
+	allFlagName          string = "all"
+
+	memoryDatabaseURLScheme string = "memory://"
+
+	shutdownTimeoutFlagName string = "shutdown-timeout"
+	drainDelayFlagName      string = "drain-delay"
+
+	tlsCertFlagName     string = "tls-cert"
+	tlsKeyFlagName      string = "tls-key"
+	tlsClientCAFlagName string = "tls-client-ca"
+	h2cFlagName         string = "h2c"
+
+	readTimeoutFlagName       string = "read-timeout"
+	readHeaderTimeoutFlagName string = "read-header-timeout"
+	writeTimeoutFlagName      string = "write-timeout"
+	idleTimeoutFlagName       string = "idle-timeout"
+	maxHeaderBytesFlagName    string = "max-header-bytes"
+	maxBodyBytesFlagName      string = "max-body-bytes"
+	handlerTimeoutFlagName    string = "handler-timeout"
+	maxBatchSizeFlagName      string = "max-batch-size"
+
+	authEnabledFlagName   string = "auth-enabled"
+	jwtHMACSecretFlagName string = "jwt-hmac-secret"
+	jwksFileFlagName      string = "jwks-file"
+	jwtIssuerFlagName     string = "jwt-issuer"
+	jwtAudienceFlagName   string = "jwt-audience"
+
+	rateLimitFlagName       string = "rate-limit"
+	rateLimitRouteFlagName  string = "rate-limit-route"
+	rateLimitSharedFlagName string = "rate-limit-shared"
+	rateLimitIPFlagName     string = "rate-limit-ip"
+
+	validateRequestsFlagName  string = "validate-requests"
+	validateResponsesFlagName string = "validate-responses"
+
+	logLevelFlagName  string = "log-level"
+	logFormatFlagName string = "log-format"
+
+	dbMaxOpenConnsFlagName    string = "db-max-open-conns"
+	dbMaxIdleConnsFlagName    string = "db-max-idle-conns"
+	dbConnMaxLifetimeFlagName string = "db-conn-max-lifetime"
+	dbConnMaxIdleTimeFlagName string = "db-conn-max-idle-time"
+	dbConnectTimeoutFlagName  string = "db-connect-timeout"
+	dbConnectRetriesFlagName  string = "db-connect-retries"
+	dbConnectBackoffFlagName  string = "db-connect-backoff"
 )
 
 func main() {
@@ -29,19 +94,27 @@ func app() *cli.App {
 		Usage: "The API",
 		Commands: []*cli.Command{
 			apiServerCmd(),
+			migrateCmd(),
+			configCmd(),
+			keysCmd(),
+			itemsCmd(),
 		},
 	}
 }
 
 func apiServerCmd() *cli.Command {
+	flags := configurable(serverFlags())
+
 	return &cli.Command{
-		Name:  "start",
-		Usage: "starts the API server",
-		Flags: []cli.Flag{
-			&cli.StringFlag{Name: apiServerAddrFlagName, EnvVars: []string{"API_SERVER_ADDR"}},
-			&cli.StringFlag{Name: apiServerStorageDatabaseURL, EnvVars: []string{"DATABASE_URL"}},
-		},
+		Name:   "start",
+		Usage:  "starts the API server",
+		Flags:  withConfigFlag(flags),
+		Before: loadConfigFile(flags),
 		Action: func(c *cli.Context) error {
+			if err := configureLogging(c); err != nil {
+				return err
+			}
+
 			done := make(chan os.Signal, 1)
 			signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 
@@ -52,14 +125,20 @@ func apiServerCmd() *cli.Command {
 			}()
 
 			addr := c.String(apiServerAddrFlagName)
-			databaserURL := c.String(apiServerStorageDatabaseURL)
-			s, err := storage.NewStorage(databaserURL)
+			s, err := itemStore(c)
 			if err != nil {
 				return fmt.Errorf("could not initialize storage: %w", err)
 			}
 
-			server, err := apiserver.NewAPIServer(addr, s)
+			opts, err := serverOptions(c)
 			if err != nil {
+				s.Close()
+				return err
+			}
+
+			server, err := apiserver.NewAPIServer(addr, s, opts)
+			if err != nil {
+				s.Close()
 				return err
 			}
 
@@ -67,3 +146,269 @@ func apiServerCmd() *cli.Command {
 		},
 	}
 }
+
+// serverFlags are the flags of the start command. Each of them can also be set
+// from the config file, see loadConfigFile.
+func serverFlags() []cli.Flag {
+	defaults := apiserver.DefaultOptions()
+
+	flags := []cli.Flag{
+		&cli.StringFlag{Name: apiServerAddrFlagName, EnvVars: []string{"API_SERVER_ADDR"}},
+		&cli.StringFlag{Name: apiServerStorageDatabaseURL, EnvVars: []string{"DATABASE_URL"}},
+		&cli.DurationFlag{Name: shutdownTimeoutFlagName, EnvVars: []string{"SHUTDOWN_TIMEOUT"}, Value: defaults.ShutdownTimeout},
+		&cli.DurationFlag{Name: drainDelayFlagName, EnvVars: []string{"DRAIN_DELAY"}, Value: defaults.DrainDelay},
+		&cli.StringFlag{Name: tlsCertFlagName, EnvVars: []string{"TLS_CERT"}, Usage: "certificate file, enables HTTPS and reloads on SIGHUP"},
+		&cli.StringFlag{Name: tlsKeyFlagName, EnvVars: []string{"TLS_KEY"}, Usage: "private key file for --tls-cert"},
+		&cli.StringFlag{Name: tlsClientCAFlagName, EnvVars: []string{"TLS_CLIENT_CA"}, Usage: "CA bundle clients must present a certificate from"},
+		&cli.BoolFlag{Name: h2cFlagName, EnvVars: []string{"H2C"}, Usage: "serve HTTP/2 without TLS"},
+		&cli.DurationFlag{Name: readTimeoutFlagName, EnvVars: []string{"READ_TIMEOUT"}, Value: defaults.ReadTimeout},
+		&cli.DurationFlag{Name: readHeaderTimeoutFlagName, EnvVars: []string{"READ_HEADER_TIMEOUT"}, Value: defaults.ReadHeaderTimeout},
+		&cli.DurationFlag{Name: writeTimeoutFlagName, EnvVars: []string{"WRITE_TIMEOUT"}, Value: defaults.WriteTimeout},
+		&cli.DurationFlag{Name: idleTimeoutFlagName, EnvVars: []string{"IDLE_TIMEOUT"}, Value: defaults.IdleTimeout},
+		&cli.IntFlag{Name: maxHeaderBytesFlagName, EnvVars: []string{"MAX_HEADER_BYTES"}, Value: defaults.MaxHeaderBytes},
+		&cli.IntFlag{Name: maxBodyBytesFlagName, EnvVars: []string{"MAX_BODY_BYTES"}, Value: int(defaults.MaxBodyBytes)},
+		&cli.DurationFlag{Name: handlerTimeoutFlagName, EnvVars: []string{"HANDLER_TIMEOUT"}, Value: defaults.HandlerTimeout, Usage: "cancels requests, and their storage calls, running longer than this, 0 disables it"},
+		&cli.IntFlag{Name: maxBatchSizeFlagName, EnvVars: []string{"MAX_BATCH_SIZE"}, Value: defaults.MaxBatchSize, Usage: "most items created by a single POST /items/batch"},
+		&cli.BoolFlag{Name: authEnabledFlagName, EnvVars: []string{"AUTH_ENABLED"}, Value: defaults.AuthEnabled, Usage: "requires an API key or a bearer token on the item routes, turn it off explicitly with --auth-enabled=false"},
+		&cli.StringFlag{Name: jwtHMACSecretFlagName, EnvVars: []string{"JWT_HMAC_SECRET"}, Usage: "secret verifying HS256 bearer tokens"},
+		&cli.StringFlag{Name: jwksFileFlagName, EnvVars: []string{"JWKS_FILE"}, Usage: "JWKS file with the keys verifying RS256 bearer tokens"},
+		&cli.StringFlag{Name: jwtIssuerFlagName, EnvVars: []string{"JWT_ISSUER"}, Usage: "iss claim bearer tokens must have"},
+		&cli.StringFlag{Name: jwtAudienceFlagName, EnvVars: []string{"JWT_AUDIENCE"}, Usage: "aud claim bearer tokens must have"},
+		&cli.StringFlag{Name: rateLimitFlagName, EnvVars: []string{"RATE_LIMIT"}, Usage: "per caller limit of the item routes, as REQUESTS/PERIOD[:BURST], e.g. 20/s:40"},
+		&cli.StringSliceFlag{Name: rateLimitRouteFlagName, EnvVars: []string{"RATE_LIMIT_ROUTES"}, Usage: "limit of a single route, as METHOD /path=REQUESTS/PERIOD[:BURST] or METHOD /path=off"},
+		&cli.StringFlag{Name: rateLimitIPFlagName, EnvVars: []string{"RATE_LIMIT_IP"}, Usage: "per address limit of the item routes, checked before authentication, as REQUESTS/PERIOD[:BURST]"},
+		&cli.BoolFlag{Name: rateLimitSharedFlagName, EnvVars: []string{"RATE_LIMIT_SHARED"}, Usage: "counts requests in the Postgres database so replicas share the limits"},
+		&cli.BoolFlag{Name: validateRequestsFlagName, EnvVars: []string{"VALIDATE_REQUESTS"}, Value: defaults.ValidateRequests, Usage: "rejects item requests with parameters or bodies that don't match the OpenAPI document"},
+		&cli.BoolFlag{Name: validateResponsesFlagName, EnvVars: []string{"VALIDATE_RESPONSES"}, Usage: "fails item responses that don't match the OpenAPI document, for development"},
+		&cli.StringFlag{Name: logLevelFlagName, EnvVars: []string{"LOG_LEVEL"}, Value: logrus.InfoLevel.String()},
+		&cli.StringFlag{Name: logFormatFlagName, EnvVars: []string{"LOG_FORMAT"}, Value: logFormatText, Usage: "text or json"},
+	}
+
+	return append(flags, storageFlags()...)
+}
+
+func serverOptions(c *cli.Context) (apiserver.Options, error) {
+	rateLimit, err := apiserver.ParseRateLimit(c.String(rateLimitFlagName))
+	if err != nil {
+		return apiserver.Options{}, err
+	}
+
+	ipRateLimit, err := apiserver.ParseRateLimit(c.String(rateLimitIPFlagName))
+	if err != nil {
+		return apiserver.Options{}, err
+	}
+
+	routeRateLimits := map[string]apiserver.RateLimit{}
+	for _, r := range c.StringSlice(rateLimitRouteFlagName) {
+		parts := strings.SplitN(r, "=", 2)
+		if len(parts) != 2 {
+			return apiserver.Options{}, fmt.Errorf("%s %q must look like METHOD /path=LIMIT", rateLimitRouteFlagName, r)
+		}
+
+		l, err := apiserver.ParseRateLimit(parts[1])
+		if err != nil {
+			return apiserver.Options{}, err
+		}
+		routeRateLimits[strings.TrimSpace(parts[0])] = l
+	}
+
+	return apiserver.Options{
+		ShutdownTimeout: c.Duration(shutdownTimeoutFlagName),
+		DrainDelay:      c.Duration(drainDelayFlagName),
+		TLSCertFile:     c.String(tlsCertFlagName),
+		TLSKeyFile:      c.String(tlsKeyFlagName),
+		TLSClientCAFile: c.String(tlsClientCAFlagName),
+		H2C:             c.Bool(h2cFlagName),
+
+		ReadTimeout:       c.Duration(readTimeoutFlagName),
+		ReadHeaderTimeout: c.Duration(readHeaderTimeoutFlagName),
+		WriteTimeout:      c.Duration(writeTimeoutFlagName),
+		IdleTimeout:       c.Duration(idleTimeoutFlagName),
+		MaxHeaderBytes:    c.Int(maxHeaderBytesFlagName),
+		MaxBodyBytes:      int64(c.Int(maxBodyBytesFlagName)),
+		HandlerTimeout:    c.Duration(handlerTimeoutFlagName),
+		MaxBatchSize:      c.Int(maxBatchSizeFlagName),
+
+		AuthEnabled:   c.Bool(authEnabledFlagName),
+		JWTHMACSecret: c.String(jwtHMACSecretFlagName),
+		JWKSFile:      c.String(jwksFileFlagName),
+		JWTIssuer:     c.String(jwtIssuerFlagName),
+		JWTAudience:   c.String(jwtAudienceFlagName),
+
+		RateLimit:        rateLimit,
+		RouteRateLimits:  routeRateLimits,
+		IPRateLimit:      ipRateLimit,
+		SharedRateLimits: c.Bool(rateLimitSharedFlagName),
+
+		ValidateRequests:  c.Bool(validateRequestsFlagName),
+		ValidateResponses: c.Bool(validateResponsesFlagName),
+	}, nil
+}
+
+// itemStore returns the store selected by the database url: memory:// keeps
+// items in process, anything else is handed to storage.NewStorage.
+func itemStore(c *cli.Context) (apiserver.ItemStore, error) {
+	databaseURL := c.String(apiServerStorageDatabaseURL)
+	if strings.HasPrefix(databaseURL, memoryDatabaseURLScheme) {
+		logrus.Warn("using in-memory storage, items will be lost on restart")
+		return storage.NewMemoryStorage(), nil
+	}
+
+	return storage.NewStorage(c.Context, databaseURL, storageOptions(c))
+}
+
+func storageFlags() []cli.Flag {
+	defaults := storage.DefaultOptions()
+
+	return []cli.Flag{
+		&cli.IntFlag{Name: dbMaxOpenConnsFlagName, EnvVars: []string{"DB_MAX_OPEN_CONNS"}, Value: defaults.MaxOpenConns},
+		&cli.IntFlag{Name: dbMaxIdleConnsFlagName, EnvVars: []string{"DB_MAX_IDLE_CONNS"}, Value: defaults.MaxIdleConns},
+		&cli.DurationFlag{Name: dbConnMaxLifetimeFlagName, EnvVars: []string{"DB_CONN_MAX_LIFETIME"}, Value: defaults.ConnMaxLifetime},
+		&cli.DurationFlag{Name: dbConnMaxIdleTimeFlagName, EnvVars: []string{"DB_CONN_MAX_IDLE_TIME"}, Value: defaults.ConnMaxIdleTime},
+		&cli.DurationFlag{Name: dbConnectTimeoutFlagName, EnvVars: []string{"DB_CONNECT_TIMEOUT"}, Value: defaults.ConnectTimeout},
+		&cli.IntFlag{Name: dbConnectRetriesFlagName, EnvVars: []string{"DB_CONNECT_RETRIES"}, Value: defaults.ConnectRetries},
+		&cli.DurationFlag{Name: dbConnectBackoffFlagName, EnvVars: []string{"DB_CONNECT_BACKOFF"}, Value: defaults.ConnectBackoff},
+	}
+}
+
+func storageOptions(c *cli.Context) storage.Options {
+	return storage.Options{
+		MaxOpenConns:    c.Int(dbMaxOpenConnsFlagName),
+		MaxIdleConns:    c.Int(dbMaxIdleConnsFlagName),
+		ConnMaxLifetime: c.Duration(dbConnMaxLifetimeFlagName),
+		ConnMaxIdleTime: c.Duration(dbConnMaxIdleTimeFlagName),
+		ConnectTimeout:  c.Duration(dbConnectTimeoutFlagName),
+		ConnectRetries:  c.Int(dbConnectRetriesFlagName),
+		ConnectBackoff:  c.Duration(dbConnectBackoffFlagName),
+	}
+}
+
+func migrateCmd() *cli.Command {
+	databaseURLFlag := &cli.StringFlag{Name: apiServerStorageDatabaseURL, EnvVars: []string{"DATABASE_URL"}}
+
+	return &cli.Command{
+		Name:  "migrate",
+		Usage: "manages the database schema using the embedded migrations",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "up",
+				Usage:     "applies pending migrations, all of them unless N is given",
+				ArgsUsage: "[N]",
+				Flags:     []cli.Flag{databaseURLFlag},
+				Action: func(c *cli.Context) error {
+					return runMigrations(c, (*storage.Migrator).Up, 0, "applied migration")
+				},
+			},
+			{
+				Name:      "down",
+				Usage:     "reverts the last N applied migrations, 1 unless N is given",
+				ArgsUsage: "[N]",
+				Flags:     []cli.Flag{databaseURLFlag},
+				Action: func(c *cli.Context) error {
+					return runMigrations(c, (*storage.Migrator).Down, 1, "reverted migration")
+				},
+			},
+			{
+				Name:  "status",
+				Usage: "lists the migrations and whether they have been applied",
+				Flags: []cli.Flag{databaseURLFlag},
+				Action: func(c *cli.Context) error {
+					m, err := migrator(c)
+					if err != nil {
+						return err
+					}
+
+					statuses, err := m.Status(c.Context)
+					if err != nil {
+						return err
+					}
+
+					w := tabwriter.NewWriter(c.App.Writer, 0, 4, 2, ' ', 0)
+					fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+					for _, st := range statuses {
+						appliedAt := "pending"
+						if st.Applied() {
+							appliedAt = st.AppliedAt.Format(time.RFC3339)
+						}
+						fmt.Fprintf(w, "%d\t%s\t%s\n", st.Version, st.Name, appliedAt)
+					}
+
+					return w.Flush()
+				},
+			},
+			{
+				Name:      "create",
+				Usage:     "creates an empty up/down migration pair",
+				ArgsUsage: "NAME",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: migrateDirFlagName, Value: "migrations"},
+				},
+				Action: func(c *cli.Context) error {
+					paths, err := storage.CreateMigration(c.String(migrateDirFlagName), strings.Join(c.Args().Slice(), " "), time.Now())
+					if err != nil {
+						return err
+					}
+
+					for _, p := range paths {
+						fmt.Fprintln(c.App.Writer, p)
+					}
+
+					return nil
+				},
+			},
+		},
+	}
+}
+
+type migrateFunc func(*storage.Migrator, context.Context, int) ([]storage.Migration, error)
+
+// runMigrations runs fn for the N given as the first argument, or defaultN
+// when there is none.
+func runMigrations(c *cli.Context, fn migrateFunc, defaultN int, verb string) error {
+	n := defaultN
+	if c.Args().Present() {
+		var err error
+		if n, err = strconv.Atoi(c.Args().First()); err != nil || n < 1 {
+			return fmt.Errorf("N must be a positive integer, got %q", c.Args().First())
+		}
+	}
+
+	m, err := migrator(c)
+	if err != nil {
+		return err
+	}
+
+	done, err := fn(m, c.Context, n)
+	for _, mig := range done {
+		logrus.WithField("version", mig.Version).WithField("name", mig.Name).Info(verb)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(done) == 0 {
+		logrus.Info("no migrations to run")
+	}
+
+	return nil
+}
+
+func migrator(c *cli.Context) (*storage.Migrator, error) {
+	s, err := openStorage(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Migrator()
+}
+
+// openStorage connects to the database of the --database-url flag for the
+// commands that work on it directly.
+func openStorage(c *cli.Context) (*storage.Storage, error) {
+	s, err := storage.NewStorage(c.Context, c.String(apiServerStorageDatabaseURL), storage.DefaultOptions())
+	if err != nil {
+		return nil, fmt.Errorf("could not initialize storage: %w", err)
+	}
+
+	return s, nil
+}
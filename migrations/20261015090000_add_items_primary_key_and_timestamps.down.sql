@@ -0,0 +1,11 @@
+DROP INDEX items_created_at_id_idx;
+DROP INDEX items_name_id_idx;
+
+DROP TRIGGER items_set_updated_at ON items;
+DROP FUNCTION set_updated_at();
+
+ALTER TABLE items
+  DROP COLUMN updated_at,
+  DROP COLUMN created_at;
+
+ALTER TABLE items DROP CONSTRAINT items_pkey;
@@ -0,0 +1,19 @@
+ALTER TABLE items ADD PRIMARY KEY (id);
+
+ALTER TABLE items
+  ADD COLUMN created_at timestamptz NOT NULL DEFAULT now(),
+  ADD COLUMN updated_at timestamptz NOT NULL DEFAULT now();
+
+CREATE OR REPLACE FUNCTION set_updated_at() RETURNS trigger AS $$
+BEGIN
+  NEW.updated_at = now();
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER items_set_updated_at
+  BEFORE UPDATE ON items
+  FOR EACH ROW EXECUTE FUNCTION set_updated_at();
+
+CREATE INDEX items_name_id_idx ON items(name, id);
+CREATE INDEX items_created_at_id_idx ON items(created_at, id);
@@ -0,0 +1,10 @@
+CREATE TABLE api_keys(
+  id uuid DEFAULT public.gen_random_uuid() PRIMARY KEY,
+  name character varying NOT NULL,
+  prefix character varying NOT NULL,
+  key_hash character varying NOT NULL,
+  created_at timestamptz NOT NULL DEFAULT now(),
+  revoked_at timestamptz
+);
+
+CREATE UNIQUE INDEX api_keys_key_hash_idx ON api_keys(key_hash);
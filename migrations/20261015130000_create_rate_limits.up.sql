@@ -0,0 +1,4 @@
+CREATE TABLE rate_limits(
+  key character varying PRIMARY KEY,
+  tat timestamptz NOT NULL
+);
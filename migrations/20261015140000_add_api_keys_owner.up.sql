@@ -0,0 +1,6 @@
+ALTER TABLE api_keys ADD COLUMN owner character varying NOT NULL DEFAULT '';
+
+UPDATE api_keys SET owner = id::text;
+
+UPDATE items SET owner_id = 'api_key:' || owner_id WHERE owner_id IN (SELECT id::text FROM api_keys);
+UPDATE items SET owner_id = 'jwt:' || owner_id WHERE owner_id NOT IN ('', 'anonymous') AND substr(owner_id, 1, 8) <> 'api_key:';
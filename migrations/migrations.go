@@ -0,0 +1,28 @@
+// Package migrations embeds the SQL migrations so the api-server binary can
+// apply them without the files being present on disk.
+package migrations
+
+import (
+	"embed"
+	"io/fs"
+)
+
+// Postgres holds the migrations for the Postgres backend.
+//
+//go:embed *.sql
+var Postgres embed.FS
+
+//go:embed sqlite/*.sql
+var sqlite embed.FS
+
+// SQLite holds the migrations for the SQLite backend.
+var SQLite = mustSub(sqlite, "sqlite")
+
+func mustSub(fsys fs.FS, dir string) fs.FS {
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+
+	return sub
+}
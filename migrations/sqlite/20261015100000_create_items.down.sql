@@ -0,0 +1,3 @@
+DROP INDEX items_created_at_id_idx;
+DROP INDEX items_name_id_idx;
+DROP TABLE items;
@@ -0,0 +1,9 @@
+CREATE TABLE items(
+  id TEXT PRIMARY KEY NOT NULL,
+  name TEXT NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ', 'now')),
+  updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ', 'now'))
+);
+
+CREATE INDEX items_name_id_idx ON items(name, id);
+CREATE INDEX items_created_at_id_idx ON items(created_at, id);
@@ -0,0 +1,10 @@
+CREATE TABLE api_keys(
+  id TEXT PRIMARY KEY NOT NULL,
+  name TEXT NOT NULL,
+  prefix TEXT NOT NULL,
+  key_hash TEXT NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ', 'now')),
+  revoked_at TIMESTAMP
+);
+
+CREATE UNIQUE INDEX api_keys_key_hash_idx ON api_keys(key_hash);
@@ -0,0 +1,5 @@
+ALTER TABLE api_keys DROP COLUMN role;
+
+DROP INDEX items_owner_id_id_idx;
+
+ALTER TABLE items DROP COLUMN owner_id;
@@ -0,0 +1,5 @@
+ALTER TABLE items ADD COLUMN owner_id TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX items_owner_id_id_idx ON items(owner_id, id);
+
+ALTER TABLE api_keys ADD COLUMN role TEXT NOT NULL DEFAULT 'writer';
@@ -0,0 +1,4 @@
+UPDATE items SET owner_id = substr(owner_id, 9) WHERE substr(owner_id, 1, 8) = 'api_key:';
+UPDATE items SET owner_id = substr(owner_id, 5) WHERE substr(owner_id, 1, 4) = 'jwt:';
+
+ALTER TABLE api_keys DROP COLUMN owner;
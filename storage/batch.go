@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/geisonsn/go-and-compose/logging"
+	"github.com/lib/pq"
+)
+
+// sqliteBatchRows keeps multi-row inserts under SQLite's limit of variables
+// per statement.
+const sqliteBatchRows = 100
+
+// CreateItems inserts the items in a single transaction, with COPY on
+// Postgres and multi-row INSERTs on SQLite: either all of them are created or
+// none is. The requests must have been validated.
+func (s *Storage) CreateItems(ctx context.Context, reqs []CreateItemRequest) ([]*Item, error) {
+	items, err := newItems(reqs)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if s.dialect == DialectSQLite {
+		err = s.insertItemsSQLite(ctx, tx, items)
+	} else {
+		err = copyItems(ctx, tx, items)
+	}
+	if err != nil {
+		return nil, conflictError(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, conflictError(err)
+	}
+
+	logging.FromContext(ctx).WithField("count", len(items)).Debug("created items")
+	return items, nil
+}
+
+// newItems builds the items of a batch, generating their ids and timestamps
+// here as COPY can't return the ones the database would default to. Times
+// are truncated to what both dialects store.
+func newItems(reqs []CreateItemRequest) ([]*Item, error) {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	items := make([]*Item, 0, len(reqs))
+	for _, r := range reqs {
+		id, err := newUUID()
+		if err != nil {
+			return nil, fmt.Errorf("could not generate item id: %w", err)
+		}
+
+		items = append(items, &Item{ID: id, Name: r.Name, OwnerID: r.OwnerID, CreatedAt: now, UpdatedAt: now})
+	}
+
+	return items, nil
+}
+
+func copyItems(ctx context.Context, tx *sql.Tx, items []*Item) error {
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("items", "id", "name", "owner_id", "created_at", "updated_at"))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, i := range items {
+		if _, err := stmt.ExecContext(ctx, i.ID, i.Name, i.OwnerID, i.CreatedAt, i.UpdatedAt); err != nil {
+			return err
+		}
+	}
+
+	// Flushes the rows, constraint violations are reported here.
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		return err
+	}
+
+	return stmt.Close()
+}
+
+func (s *Storage) insertItemsSQLite(ctx context.Context, tx *sql.Tx, items []*Item) error {
+	for start := 0; start < len(items); start += sqliteBatchRows {
+		end := start + sqliteBatchRows
+		if end > len(items) {
+			end = len(items)
+		}
+
+		var (
+			rows []string
+			args []interface{}
+		)
+		for _, i := range items[start:end] {
+			n := len(args)
+			rows = append(rows, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5))
+			args = append(args, i.ID, i.Name, i.OwnerID, s.timeArg(i.CreatedAt), s.timeArg(i.UpdatedAt))
+		}
+
+		query := "INSERT INTO items(id, name, owner_id, created_at, updated_at) VALUES " + strings.Join(rows, ", ")
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"errors"
+	"io/fs"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/geisonsn/go-and-compose/migrations"
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+const (
+	DialectPostgres = "postgres"
+	DialectSQLite   = "sqlite"
+
+	sqliteURLScheme = "sqlite://"
+
+	// sqliteTimeLayout is how timestamps are stored in SQLite. It has a fixed
+	// width, the same as strftime('%Y-%m-%dT%H:%M:%fZ'), so comparing the text
+	// orders by time.
+	sqliteTimeLayout = "2006-01-02T15:04:05.000Z"
+)
+
+// sqlitePragmas are run on every new SQLite connection.
+var sqlitePragmas = []string{
+	"foreign_keys(1)",
+	"busy_timeout(5000)",
+	"journal_mode(WAL)",
+	"case_sensitive_like(1)",
+}
+
+// parseDatabaseURL picks the driver for databaseURL from its scheme:
+// sqlite://path/to/file.db uses SQLite, anything else is passed to lib/pq.
+func parseDatabaseURL(databaseURL string) (driver, dataSource, dialect string, err error) {
+	if !strings.HasPrefix(databaseURL, sqliteURLScheme) {
+		return "postgres", databaseURL, DialectPostgres, nil
+	}
+
+	path := strings.TrimPrefix(databaseURL, sqliteURLScheme)
+	query := url.Values{}
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		if query, err = url.ParseQuery(path[i+1:]); err != nil {
+			return "", "", "", err
+		}
+		path = path[:i]
+	}
+	if path == "" {
+		return "", "", "", errors.New("sqlite database url needs a file path")
+	}
+
+	query["_pragma"] = append(append([]string{}, sqlitePragmas...), query["_pragma"]...)
+	return "sqlite", path + "?" + query.Encode(), DialectSQLite, nil
+}
+
+// Dialect returns the SQL dialect of the database, DialectPostgres or
+// DialectSQLite.
+func (s *Storage) Dialect() string {
+	return s.dialect
+}
+
+// timeArg converts t to the representation the dialect compares correctly.
+func (s *Storage) timeArg(t time.Time) interface{} {
+	if s.dialect == DialectSQLite {
+		return t.UTC().Format(sqliteTimeLayout)
+	}
+
+	return t
+}
+
+// migrations returns the embedded migrations for the dialect.
+func (s *Storage) migrations() fs.FS {
+	if s.dialect == DialectSQLite {
+		return migrations.SQLite
+	}
+
+	return migrations.Postgres
+}
+
+// uniqueViolation reports whether err is a uniqueness violation, and on which
+// constraint when the driver says.
+func uniqueViolation(err error) (string, bool) {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return pqErr.Constraint, true
+	}
+
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.Code() {
+		case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+			return "unique", true
+		}
+	}
+
+	return "", false
+}
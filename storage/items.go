@@ -2,31 +2,195 @@ package storage
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/geisonsn/go-and-compose/logging"
+	"github.com/geisonsn/go-and-compose/validation"
+	"github.com/lib/pq"
+)
+
+const (
+	itemColumns = "id, name, owner_id, created_at, updated_at"
+
+	itemNameMaxLength = 255
+	itemNameAllowed   = "letters, digits, spaces and . , ' & ( ) - _"
 )
 
+var itemNamePattern = regexp.MustCompile(`^[\p{L}\p{N} .,'&()_-]+$`)
+
 type CreateItemRequest struct {
-	Name string
+	Name string `json:"name"`
+	// OwnerID is set by the server to the caller creating the item.
+	OwnerID string `json:"-"`
+}
+
+type UpdateItemRequest struct {
+	Name *string `json:"name"`
+}
+
+// Validate trims the request fields and checks them against the item rules.
+func (r *CreateItemRequest) Validate() error {
+	r.Name = strings.TrimSpace(r.Name)
+
+	v := validation.New()
+	validateItemName(v, r.Name)
+	return v.Err()
+}
+
+// Validate trims the fields present in the request and checks them against
+// the item rules. Absent fields are left untouched by UpdateItem.
+func (r *UpdateItemRequest) Validate() error {
+	v := validation.New()
+	if r.Name != nil {
+		name := strings.TrimSpace(*r.Name)
+		r.Name = &name
+		validateItemName(v, name)
+	}
+
+	return v.Err()
+}
+
+func validateItemName(v *validation.Validator, name string) {
+	v.Required("name", name).
+		MinLength("name", name, 1).
+		MaxLength("name", name, itemNameMaxLength).
+		Matches("name", name, itemNamePattern, itemNameAllowed)
 }
 
 type Item struct {
-	ID   string
-	Name string
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	OwnerID   string    `json:"owner_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 func (s *Storage) CreateItem(ctx context.Context, i CreateItemRequest) (*Item, error) {
-	row := s.conn.QueryRowContext(ctx, "INSERT INTO items(name) VALUES($1) RETURNING id, name", i.Name)
-	return ScanItem(row)
+	var (
+		item *Item
+		err  error
+	)
+	if s.dialect == DialectSQLite {
+		item, err = s.createItemSQLite(ctx, i)
+	} else {
+		row := s.conn.QueryRowContext(ctx, "INSERT INTO items(name, owner_id) VALUES($1, $2) RETURNING "+itemColumns, i.Name, i.OwnerID)
+		item, err = ScanItem(row)
+	}
+	if err != nil {
+		return nil, conflictError(err)
+	}
+
+	logging.FromContext(ctx).WithField("item_id", item.ID).Debug("created item")
+	return item, nil
+}
+
+func (s *Storage) GetItem(ctx context.Context, id string) (*Item, error) {
+	row := s.conn.QueryRowContext(ctx, "SELECT "+itemColumns+" FROM items WHERE id = $1", id)
+	item, err := ScanItem(row)
+	if err != nil {
+		return nil, itemError(id, err)
+	}
+
+	return item, nil
+}
+
+func (s *Storage) UpdateItem(ctx context.Context, id string, i UpdateItemRequest) (*Item, error) {
+	if s.dialect == DialectSQLite {
+		item, err := s.updateItemSQLite(ctx, id, i)
+		if err != nil {
+			return nil, itemError(id, err)
+		}
+
+		return item, nil
+	}
+
+	row := s.conn.QueryRowContext(ctx, "UPDATE items SET name = COALESCE($2, name) WHERE id = $1 RETURNING "+itemColumns, id, i.Name)
+	item, err := ScanItem(row)
+	if err != nil {
+		return nil, itemError(id, err)
+	}
+
+	return item, nil
+}
+
+// createItemSQLite generates the id and timestamps that Postgres defaults,
+// then reads the row back as SQLite stored it.
+func (s *Storage) createItemSQLite(ctx context.Context, i CreateItemRequest) (*Item, error) {
+	id, err := newUUID()
+	if err != nil {
+		return nil, fmt.Errorf("could not generate item id: %w", err)
+	}
+
+	now := s.timeArg(time.Now())
+	if _, err := s.conn.ExecContext(ctx, "INSERT INTO items(id, name, owner_id, created_at, updated_at) VALUES($1, $2, $3, $4, $4)", id, i.Name, i.OwnerID, now); err != nil {
+		return nil, err
+	}
+
+	return ScanItem(s.conn.QueryRowContext(ctx, "SELECT "+itemColumns+" FROM items WHERE id = $1", id))
+}
+
+// updateItemSQLite sets updated_at itself, there is no trigger for it in the
+// SQLite schema.
+func (s *Storage) updateItemSQLite(ctx context.Context, id string, i UpdateItemRequest) (*Item, error) {
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "UPDATE items SET name = COALESCE($2, name), updated_at = $3 WHERE id = $1", id, i.Name, s.timeArg(time.Now()))
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	item, err := ScanItem(tx.QueryRowContext(ctx, "SELECT "+itemColumns+" FROM items WHERE id = $1", id))
+	if err != nil {
+		return nil, err
+	}
+
+	return item, tx.Commit()
+}
+
+func (s *Storage) DeleteItem(ctx context.Context, id string) error {
+	res, err := s.conn.ExecContext(ctx, "DELETE FROM items WHERE id = $1", id)
+	if err != nil {
+		return itemError(id, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not delete item: %w", err)
+	}
+	if n == 0 {
+		return &NotFoundError{Resource: "item", ID: id}
+	}
+
+	logging.FromContext(ctx).WithField("item_id", id).Debug("deleted item")
+	return nil
 }
 
-func (s *Storage) ListItems(ctx context.Context) ([]*Item, error) {
-	rows, err := s.conn.QueryContext(ctx, "SELECT id, name FROM items")
+func (s *Storage) ListItems(ctx context.Context, q ListItemsQuery) (*ItemPage, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+
+	query, args := q.sql(s.timeArg)
+	logging.FromContext(ctx).WithField("query", query).Debug("listing items")
+	rows, err := s.conn.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("could not retrieve items: %w", err)
 	}
 	defer rows.Close()
 
-	var items []*Item
+	items := make([]*Item, 0, q.Limit+1)
 	for rows.Next() {
 		item, err := ScanItem(rows)
 		if err != nil {
@@ -35,15 +199,47 @@ func (s *Storage) ListItems(ctx context.Context) ([]*Item, error) {
 
 		items = append(items, item)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not retrieve items: %w", err)
+	}
+
+	page := &ItemPage{Items: items}
+	if len(items) > q.Limit {
+		page.Items = items[:q.Limit]
+		page.NextCursor = q.nextCursor(page.Items[q.Limit-1])
+	}
 
-	return items, nil
+	return page, nil
 }
 
 func ScanItem(s Scanner) (*Item, error) {
 	i := &Item{}
-	if err := s.Scan(&i.ID, &i.Name); err != nil {
+	if err := s.Scan(&i.ID, &i.Name, &i.OwnerID, &i.CreatedAt, &i.UpdatedAt); err != nil {
 		return nil, err
 	}
 
 	return i, nil
 }
+
+// itemError converts lookups that can't match a row, either because there is
+// none or because the id isn't a valid uuid, into a NotFoundError.
+func itemError(id string, err error) error {
+	if isNoMatch(err) {
+		return &NotFoundError{Resource: "item", ID: id}
+	}
+
+	return conflictError(err)
+}
+
+func isNoMatch(err error) bool {
+	var pqErr *pq.Error
+	return errors.Is(err, sql.ErrNoRows) || (errors.As(err, &pqErr) && pqErr.Code == "22P02")
+}
+
+func conflictError(err error) error {
+	if constraint, ok := uniqueViolation(err); ok {
+		return &ConflictError{Resource: "item", Constraint: constraint}
+	}
+
+	return err
+}
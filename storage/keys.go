@@ -0,0 +1,229 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/geisonsn/go-and-compose/validation"
+)
+
+const (
+	// APIKeyPrefix starts every generated key, so they are easy to tell
+	// apart from JWTs and to spot in leaked text.
+	APIKeyPrefix = "ak_"
+
+	apiKeyColumns = "id, name, prefix, role, owner, created_at, revoked_at"
+
+	// apiKeyDisplayLength is how much of a key is kept in clear to identify
+	// it in listings.
+	apiKeyDisplayLength = 10
+)
+
+// Role is what a caller is allowed to do. Each role can do everything the
+// previous ones can.
+type Role string
+
+const (
+	// RoleReader can read its own items.
+	RoleReader Role = "reader"
+	// RoleWriter can also create, change and delete its own items.
+	RoleWriter Role = "writer"
+	// RoleAdmin can do all of it on the items of every owner.
+	RoleAdmin Role = "admin"
+)
+
+var roleRanks = map[Role]int{RoleReader: 1, RoleWriter: 2, RoleAdmin: 3}
+
+// Valid reports whether r is one of the known roles.
+func (r Role) Valid() bool {
+	_, ok := roleRanks[r]
+	return ok
+}
+
+// Allows reports whether r grants at least the permissions of required.
+func (r Role) Allows(required Role) bool {
+	return r.Valid() && roleRanks[r] >= roleRanks[required]
+}
+
+type CreateAPIKeyRequest struct {
+	Name string `json:"name"`
+	// Role defaults to RoleWriter.
+	Role Role `json:"role"`
+	// Owner owns the items created with the key. Keys created for the same
+	// owner share them, so a key can be rotated without losing its items.
+	// It defaults to the id of the key.
+	Owner string `json:"owner"`
+}
+
+// APIKey describes a key. The key itself is only known when it is created,
+// only its hash is stored.
+type APIKey struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Prefix    string     `json:"prefix"`
+	Role      Role       `json:"role"`
+	Owner     string     `json:"owner"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+func (r *CreateAPIKeyRequest) Validate() error {
+	r.Name = strings.TrimSpace(r.Name)
+	r.Owner = strings.TrimSpace(r.Owner)
+	if r.Role == "" {
+		r.Role = RoleWriter
+	}
+
+	v := validation.New()
+	v.Required("name", r.Name).MaxLength("name", r.Name, 255).MaxLength("owner", r.Owner, 255)
+	if !r.Role.Valid() {
+		v.Invalid("role", fmt.Sprintf("must be one of %s, %s, %s", RoleReader, RoleWriter, RoleAdmin))
+	}
+	return v.Err()
+}
+
+// HashAPIKey returns the digest keys are stored and looked up by. Keys are
+// random, so a fast unsalted hash is enough.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func generateAPIKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return APIKeyPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// newAPIKey generates a key for r, returning its record and the key in clear.
+func newAPIKey(r CreateAPIKeyRequest) (*APIKey, string, error) {
+	if err := r.Validate(); err != nil {
+		return nil, "", err
+	}
+
+	id, err := newUUID()
+	if err != nil {
+		return nil, "", fmt.Errorf("could not generate api key id: %w", err)
+	}
+
+	key, err := generateAPIKey()
+	if err != nil {
+		return nil, "", fmt.Errorf("could not generate api key: %w", err)
+	}
+
+	owner := r.Owner
+	if owner == "" {
+		owner = id
+	}
+
+	return &APIKey{
+		ID:        id,
+		Name:      r.Name,
+		Prefix:    key[:apiKeyDisplayLength],
+		Role:      r.Role,
+		Owner:     owner,
+		CreatedAt: time.Now().UTC(),
+	}, key, nil
+}
+
+// CreateAPIKey stores a new key and returns it in clear, which is the only
+// time it is available.
+func (s *Storage) CreateAPIKey(ctx context.Context, r CreateAPIKeyRequest) (*APIKey, string, error) {
+	k, key, err := newAPIKey(r)
+	if err != nil {
+		return nil, "", err
+	}
+
+	_, err = s.conn.ExecContext(ctx, "INSERT INTO api_keys(id, name, prefix, role, owner, key_hash, created_at) VALUES($1, $2, $3, $4, $5, $6, $7)",
+		k.ID, k.Name, k.Prefix, k.Role, k.Owner, HashAPIKey(key), s.timeArg(k.CreatedAt))
+	if err != nil {
+		return nil, "", fmt.Errorf("could not create api key: %w", err)
+	}
+
+	return k, key, nil
+}
+
+func (s *Storage) ListAPIKeys(ctx context.Context) ([]*APIKey, error) {
+	rows, err := s.conn.QueryContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys ORDER BY created_at, id")
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve api keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []*APIKey
+	for rows.Next() {
+		k, err := ScanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan api key: %w", err)
+		}
+
+		keys = append(keys, k)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not retrieve api keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+// RevokeAPIKey stops a key from authenticating. The record is kept for
+// auditing.
+func (s *Storage) RevokeAPIKey(ctx context.Context, id string) error {
+	res, err := s.conn.ExecContext(ctx, "UPDATE api_keys SET revoked_at = $2 WHERE id = $1 AND revoked_at IS NULL", id, s.timeArg(time.Now()))
+	if err != nil {
+		return apiKeyError(id, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not revoke api key: %w", err)
+	}
+	if n == 0 {
+		return &NotFoundError{Resource: "api key", ID: id}
+	}
+
+	return nil
+}
+
+// APIKeyByHash returns the active key with the given hash.
+func (s *Storage) APIKeyByHash(ctx context.Context, hash string) (*APIKey, error) {
+	row := s.conn.QueryRowContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE key_hash = $1 AND revoked_at IS NULL", hash)
+	k, err := ScanAPIKey(row)
+	if err != nil {
+		return nil, apiKeyError("", err)
+	}
+
+	return k, nil
+}
+
+func ScanAPIKey(s Scanner) (*APIKey, error) {
+	k := &APIKey{}
+	var revokedAt sql.NullTime
+	if err := s.Scan(&k.ID, &k.Name, &k.Prefix, &k.Role, &k.Owner, &k.CreatedAt, &revokedAt); err != nil {
+		return nil, err
+	}
+
+	if revokedAt.Valid {
+		k.RevokedAt = &revokedAt.Time
+	}
+
+	return k, nil
+}
+
+func apiKeyError(id string, err error) error {
+	if isNoMatch(err) {
+		return &NotFoundError{Resource: "api key", ID: id}
+	}
+
+	return err
+}
@@ -0,0 +1,274 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStorage keeps items in process memory. It is meant for local runs and
+// tests; nothing survives a restart.
+type MemoryStorage struct {
+	mu    sync.RWMutex
+	items map[string]Item
+	keys  map[string]memoryAPIKey
+}
+
+type memoryAPIKey struct {
+	APIKey
+	hash string
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{items: map[string]Item{}, keys: map[string]memoryAPIKey{}}
+}
+
+func (s *MemoryStorage) CreateItem(ctx context.Context, i CreateItemRequest) (*Item, error) {
+	id, err := newUUID()
+	if err != nil {
+		return nil, fmt.Errorf("could not generate item id: %w", err)
+	}
+
+	now := time.Now().UTC()
+	item := Item{ID: id, Name: i.Name, OwnerID: i.OwnerID, CreatedAt: now, UpdatedAt: now}
+
+	s.mu.Lock()
+	s.items[id] = item
+	s.mu.Unlock()
+
+	return &item, nil
+}
+
+// CreateItems adds all the items at once.
+func (s *MemoryStorage) CreateItems(ctx context.Context, reqs []CreateItemRequest) ([]*Item, error) {
+	items, err := newItems(reqs)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	for _, item := range items {
+		s.items[item.ID] = *item
+	}
+	s.mu.Unlock()
+
+	return items, nil
+}
+
+func (s *MemoryStorage) GetItem(ctx context.Context, id string) (*Item, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	item, ok := s.items[id]
+	if !ok {
+		return nil, &NotFoundError{Resource: "item", ID: id}
+	}
+
+	return &item, nil
+}
+
+func (s *MemoryStorage) UpdateItem(ctx context.Context, id string, i UpdateItemRequest) (*Item, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, ok := s.items[id]
+	if !ok {
+		return nil, &NotFoundError{Resource: "item", ID: id}
+	}
+
+	if i.Name != nil {
+		item.Name = *i.Name
+	}
+	item.UpdatedAt = time.Now().UTC()
+	s.items[id] = item
+
+	return &item, nil
+}
+
+func (s *MemoryStorage) DeleteItem(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.items[id]; !ok {
+		return &NotFoundError{Resource: "item", ID: id}
+	}
+
+	delete(s.items, id)
+	return nil
+}
+
+func (s *MemoryStorage) ListItems(ctx context.Context, q ListItemsQuery) (*ItemPage, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+
+	var after *Item
+	if q.Cursor != "" {
+		c, err := decodeItemCursor(q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+
+		after = &Item{ID: c.ID, Name: c.Value}
+		if q.Sort == ItemSortCreatedAt {
+			if after.CreatedAt, err = time.Parse(time.RFC3339Nano, c.Value); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	less := func(a, b *Item) bool {
+		c := compareItems(a, b, q.Sort)
+		if q.Direction == SortDesc {
+			return c > 0
+		}
+
+		return c < 0
+	}
+
+	s.mu.RLock()
+	items := make([]*Item, 0, len(s.items))
+	for _, item := range s.items {
+		item := item
+		if q.OwnerID != "" && item.OwnerID != q.OwnerID {
+			continue
+		}
+		if q.NamePrefix != "" && !strings.HasPrefix(item.Name, q.NamePrefix) {
+			continue
+		}
+		if q.NameContains != "" && !strings.Contains(strings.ToLower(item.Name), strings.ToLower(q.NameContains)) {
+			continue
+		}
+		if after != nil && !less(after, &item) {
+			continue
+		}
+
+		items = append(items, &item)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(items, func(i, j int) bool { return less(items[i], items[j]) })
+
+	page := &ItemPage{Items: items}
+	if len(items) > q.Limit {
+		page.Items = items[:q.Limit]
+		page.NextCursor = q.nextCursor(page.Items[q.Limit-1])
+	}
+
+	return page, nil
+}
+
+func (s *MemoryStorage) CreateAPIKey(ctx context.Context, r CreateAPIKeyRequest) (*APIKey, string, error) {
+	k, key, err := newAPIKey(r)
+	if err != nil {
+		return nil, "", err
+	}
+
+	s.mu.Lock()
+	s.keys[k.ID] = memoryAPIKey{APIKey: *k, hash: HashAPIKey(key)}
+	s.mu.Unlock()
+
+	return k, key, nil
+}
+
+func (s *MemoryStorage) ListAPIKeys(ctx context.Context) ([]*APIKey, error) {
+	s.mu.RLock()
+	keys := make([]*APIKey, 0, len(s.keys))
+	for _, k := range s.keys {
+		k := k.APIKey
+		keys = append(keys, &k)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+		}
+
+		return keys[i].ID < keys[j].ID
+	})
+
+	return keys, nil
+}
+
+func (s *MemoryStorage) RevokeAPIKey(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k, ok := s.keys[id]
+	if !ok || k.RevokedAt != nil {
+		return &NotFoundError{Resource: "api key", ID: id}
+	}
+
+	now := time.Now().UTC()
+	k.RevokedAt = &now
+	s.keys[id] = k
+
+	return nil
+}
+
+func (s *MemoryStorage) APIKeyByHash(ctx context.Context, hash string) (*APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, k := range s.keys {
+		if k.hash == hash && k.RevokedAt == nil {
+			key := k.APIKey
+			return &key, nil
+		}
+	}
+
+	return nil, &NotFoundError{Resource: "api key"}
+}
+
+// Ping always succeeds, there is nothing to connect to.
+func (s *MemoryStorage) Ping(ctx context.Context) error {
+	return nil
+}
+
+// Stats returns empty statistics, there is no connection pool.
+func (s *MemoryStorage) Stats() sql.DBStats {
+	return sql.DBStats{}
+}
+
+// Close is a no-op, there is nothing to release.
+func (s *MemoryStorage) Close() error {
+	return nil
+}
+
+// compareItems orders a and b by field, breaking ties by id like the
+// ORDER BY used by Storage.ListItems.
+func compareItems(a, b *Item, field string) int {
+	switch field {
+	case ItemSortName:
+		if c := strings.Compare(a.Name, b.Name); c != 0 {
+			return c
+		}
+	case ItemSortCreatedAt:
+		if a.CreatedAt.Before(b.CreatedAt) {
+			return -1
+		}
+		if a.CreatedAt.After(b.CreatedAt) {
+			return 1
+		}
+	}
+
+	return strings.Compare(a.ID, b.ID)
+}
+
+// newUUID returns a random version 4 uuid.
+func newUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
@@ -0,0 +1,402 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	migrationVersionLayout = "20060102150405"
+
+	// migrationLockID is the advisory lock held while migrating so replicas
+	// starting together don't race each other.
+	migrationLockID = 72207211
+)
+
+const createSchemaVersionsSQL = `CREATE TABLE IF NOT EXISTS schema_versions(
+  version bigint PRIMARY KEY,
+  name character varying NOT NULL,
+  applied_at timestamptz NOT NULL DEFAULT now()
+)`
+
+const createSQLiteSchemaVersionsSQL = `CREATE TABLE IF NOT EXISTS schema_versions(
+  version INTEGER PRIMARY KEY,
+  name TEXT NOT NULL,
+  applied_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ', 'now'))
+)`
+
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+func (s MigrationStatus) Applied() bool {
+	return s.AppliedAt != nil
+}
+
+// LoadMigrations reads every <version>_<name>.(up|down).sql file in fsys,
+// ordered by version.
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("could not read migrations: %w", err)
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, e := range entries {
+		m := migrationFilePattern.FindStringSubmatch(e.Name())
+		if e.IsDir() || m == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version %s: %w", e.Name(), err)
+		}
+
+		b, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, fmt.Errorf("could not read migration %s: %w", e.Name(), err)
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		}
+		if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %s and %s", version, mig.Name, m[2])
+		}
+
+		if m[3] == "up" {
+			mig.Up = string(b)
+		} else {
+			mig.Down = string(b)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// CreateMigration writes an empty up/down pair named after name into dir and
+// returns their paths.
+func CreateMigration(dir, name string, now time.Time) ([]string, error) {
+	name = strings.ToLower(strings.Join(strings.Fields(name), "_"))
+	if name == "" {
+		return nil, errors.New("migration name cannot be blank")
+	}
+
+	base := fmt.Sprintf("%s_%s", now.UTC().Format(migrationVersionLayout), name)
+	paths := []string{
+		filepath.Join(dir, base+".up.sql"),
+		filepath.Join(dir, base+".down.sql"),
+	}
+
+	for _, p := range paths {
+		f, err := os.OpenFile(p, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("could not create migration: %w", err)
+		}
+		f.Close()
+	}
+
+	return paths, nil
+}
+
+// Migrator applies migrations and records them in the schema_versions table.
+type Migrator struct {
+	conn       *sql.DB
+	dialect    string
+	migrations []Migration
+}
+
+// Migrator returns a Migrator for the embedded migrations of the storage's
+// dialect.
+func (s *Storage) Migrator() (*Migrator, error) {
+	migrations, err := LoadMigrations(s.migrations())
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{conn: s.conn, dialect: s.dialect, migrations: migrations}, nil
+}
+
+// PendingMigrations returns the embedded migrations not yet applied to the
+// database.
+func (s *Storage) PendingMigrations(ctx context.Context) ([]Migration, error) {
+	m, err := s.Migrator()
+	if err != nil {
+		return nil, err
+	}
+
+	return m.Pending(ctx)
+}
+
+// Status reports every known migration and when it was applied, if at all.
+// It only reads, so it is safe for readiness checks: a database without
+// schema_versions has every migration pending.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	conn, err := m.conn.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not acquire connection: %w", err)
+	}
+	defer conn.Close()
+
+	exists, err := m.versionTableExists(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return m.statuses(nil), nil
+	}
+
+	return m.status(ctx, conn)
+}
+
+// Pending returns the migrations that have not been applied yet.
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, st := range statuses {
+		if !st.Applied() {
+			pending = append(pending, st.Migration)
+		}
+	}
+
+	return pending, nil
+}
+
+// Up applies up to n pending migrations in version order, or all of them when
+// n is not positive.
+func (m *Migrator) Up(ctx context.Context, n int) ([]Migration, error) {
+	return m.run(ctx, func(statuses []MigrationStatus) []Migration {
+		var todo []Migration
+		for _, st := range statuses {
+			if !st.Applied() {
+				todo = append(todo, st.Migration)
+			}
+		}
+
+		return limitMigrations(todo, n)
+	}, true)
+}
+
+// Down reverts the n most recently applied migrations, or all of them when n
+// is not positive.
+func (m *Migrator) Down(ctx context.Context, n int) ([]Migration, error) {
+	return m.run(ctx, func(statuses []MigrationStatus) []Migration {
+		var todo []Migration
+		for i := len(statuses) - 1; i >= 0; i-- {
+			if statuses[i].Applied() {
+				todo = append(todo, statuses[i].Migration)
+			}
+		}
+
+		return limitMigrations(todo, n)
+	}, false)
+}
+
+func limitMigrations(migrations []Migration, n int) []Migration {
+	if n > 0 && n < len(migrations) {
+		return migrations[:n]
+	}
+
+	return migrations
+}
+
+func (m *Migrator) run(ctx context.Context, plan func([]MigrationStatus) []Migration, up bool) ([]Migration, error) {
+	conn, err := m.conn.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not acquire connection: %w", err)
+	}
+	defer conn.Close()
+
+	// SQLite serializes writers on its own, Postgres needs to be told.
+	if m.dialect == DialectPostgres {
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+			return nil, fmt.Errorf("could not acquire migration lock: %w", err)
+		}
+		defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockID)
+	}
+
+	if err := m.ensureVersionTable(ctx, conn); err != nil {
+		return nil, err
+	}
+
+	statuses, err := m.status(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, mig := range plan(statuses) {
+		if err := m.apply(ctx, conn, mig, up); err != nil {
+			return done, err
+		}
+
+		done = append(done, mig)
+	}
+
+	return done, nil
+}
+
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, mig Migration, up bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin migration %d: %w", mig.Version, err)
+	}
+	defer tx.Rollback()
+
+	script, record := mig.Up, "INSERT INTO schema_versions(version, name) VALUES($1, $2)"
+	if !up {
+		script, record = mig.Down, "DELETE FROM schema_versions WHERE version = $1 AND name = $2"
+	}
+
+	if strings.TrimSpace(script) != "" {
+		if _, err := tx.ExecContext(ctx, script); err != nil {
+			return fmt.Errorf("could not run migration %d_%s: %w", mig.Version, mig.Name, err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, record, mig.Version, mig.Name); err != nil {
+		return fmt.Errorf("could not record migration %d: %w", mig.Version, err)
+	}
+
+	return tx.Commit()
+}
+
+func (m *Migrator) status(ctx context.Context, conn *sql.Conn) ([]MigrationStatus, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_versions")
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve schema versions: %w", err)
+	}
+	defer rows.Close()
+
+	applied := map[int64]time.Time{}
+	for rows.Next() {
+		var (
+			version int64
+			at      time.Time
+		)
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, fmt.Errorf("could not scan schema version: %w", err)
+		}
+
+		applied[version] = at
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not retrieve schema versions: %w", err)
+	}
+
+	return m.statuses(applied), nil
+}
+
+// statuses pairs the known migrations with when they were applied.
+func (m *Migrator) statuses(applied map[int64]time.Time) []MigrationStatus {
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		st := MigrationStatus{Migration: mig}
+		if at, ok := applied[mig.Version]; ok {
+			st.AppliedAt = &at
+		}
+
+		statuses = append(statuses, st)
+	}
+
+	return statuses
+}
+
+func (m *Migrator) versionTableExists(ctx context.Context, conn *sql.Conn) (bool, error) {
+	query := "SELECT to_regclass('schema_versions') IS NOT NULL"
+	if m.dialect == DialectSQLite {
+		query = "SELECT count(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = 'schema_versions'"
+	}
+
+	var exists bool
+	if err := conn.QueryRowContext(ctx, query).Scan(&exists); err != nil {
+		return false, fmt.Errorf("could not check schema versions: %w", err)
+	}
+
+	return exists, nil
+}
+
+// ensureVersionTable creates schema_versions on first use. Databases that were
+// migrated with the migrate/migrate container have their clean
+// schema_migrations version adopted, so those migrations aren't run twice.
+func (m *Migrator) ensureVersionTable(ctx context.Context, conn *sql.Conn) error {
+	if m.dialect == DialectSQLite {
+		if _, err := conn.ExecContext(ctx, createSQLiteSchemaVersionsSQL); err != nil {
+			return fmt.Errorf("could not create schema versions: %w", err)
+		}
+
+		return nil
+	}
+
+	var exists, legacyExists bool
+	row := conn.QueryRowContext(ctx, "SELECT to_regclass('schema_versions') IS NOT NULL, to_regclass('schema_migrations') IS NOT NULL")
+	if err := row.Scan(&exists, &legacyExists); err != nil {
+		return fmt.Errorf("could not check schema versions: %w", err)
+	}
+	if exists {
+		return nil
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not create schema versions: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, createSchemaVersionsSQL); err != nil {
+		return fmt.Errorf("could not create schema versions: %w", err)
+	}
+
+	if legacyExists {
+		var legacy int64
+		err := tx.QueryRowContext(ctx, "SELECT version FROM schema_migrations WHERE NOT dirty").Scan(&legacy)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("could not read legacy schema migrations: %w", err)
+		}
+
+		for _, mig := range m.migrations {
+			if err != nil || mig.Version > legacy {
+				break
+			}
+
+			if _, err := tx.ExecContext(ctx, "INSERT INTO schema_versions(version, name) VALUES($1, $2)", mig.Version, mig.Name); err != nil {
+				return fmt.Errorf("could not adopt legacy migration %d: %w", mig.Version, err)
+			}
+		}
+	}
+
+	return tx.Commit()
+}
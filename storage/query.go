@@ -0,0 +1,182 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/geisonsn/go-and-compose/validation"
+)
+
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 200
+
+	ItemSortID        = "id"
+	ItemSortName      = "name"
+	ItemSortCreatedAt = "created_at"
+
+	SortAsc  = "asc"
+	SortDesc = "desc"
+)
+
+// ListItemsQuery selects a page of items. The zero value returns the first
+// DefaultListLimit items ordered by id.
+type ListItemsQuery struct {
+	Limit        int
+	Cursor       string
+	Sort         string
+	Direction    string
+	NamePrefix   string
+	NameContains string
+	// OwnerID restricts the page to the items of an owner. Empty lists the
+	// items of every owner.
+	OwnerID string
+}
+
+// ItemPage is a single page of items. NextCursor is empty on the last page.
+type ItemPage struct {
+	Items      []*Item `json:"items"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+// uuidPattern matches item ids. Cursors with anything else would make
+// Postgres fail the comparison with the uuid column.
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// itemCursor is the position after the last item of a page. It records the
+// ordering it was produced with so it can't be replayed against another one.
+type itemCursor struct {
+	Sort      string `json:"s"`
+	Direction string `json:"d"`
+	Value     string `json:"v"`
+	ID        string `json:"id"`
+}
+
+// Validate fills in defaults and checks the query, including that the cursor
+// was produced for the same ordering.
+func (q *ListItemsQuery) Validate() error {
+	if q.Limit == 0 {
+		q.Limit = DefaultListLimit
+	}
+	if q.Sort == "" {
+		q.Sort = ItemSortID
+	}
+	if q.Direction == "" {
+		q.Direction = SortAsc
+	}
+
+	v := validation.New()
+	if q.Limit < 1 || q.Limit > MaxListLimit {
+		v.Invalid("limit", fmt.Sprintf("must be between 1 and %d", MaxListLimit))
+	}
+	switch q.Sort {
+	case ItemSortID, ItemSortName, ItemSortCreatedAt:
+	default:
+		v.Invalid("sort", fmt.Sprintf("must be one of %s, %s, %s", ItemSortID, ItemSortName, ItemSortCreatedAt))
+	}
+	if q.Direction != SortAsc && q.Direction != SortDesc {
+		v.Invalid("order", fmt.Sprintf("must be one of %s, %s", SortAsc, SortDesc))
+	}
+	if q.Cursor != "" {
+		c, err := decodeItemCursor(q.Cursor)
+		if err == nil && c.Sort == ItemSortCreatedAt {
+			_, err = time.Parse(time.RFC3339Nano, c.Value)
+		}
+		if err != nil || c.Sort != q.Sort || c.Direction != q.Direction || !uuidPattern.MatchString(c.ID) {
+			v.Invalid("cursor", "is not valid for this query")
+		}
+	}
+
+	return v.Err()
+}
+
+// sql builds the SELECT for the query, fetching one extra row so the caller
+// can tell whether there is a next page. timeArg converts times to the
+// dialect's representation.
+func (q ListItemsQuery) sql(timeArg func(time.Time) interface{}) (string, []interface{}) {
+	var (
+		where []string
+		args  []interface{}
+	)
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if q.OwnerID != "" {
+		where = append(where, fmt.Sprintf("owner_id = %s", arg(q.OwnerID)))
+	}
+	if q.NamePrefix != "" {
+		where = append(where, fmt.Sprintf(`name LIKE %s ESCAPE '\'`, arg(escapeLike(q.NamePrefix)+"%")))
+	}
+	if q.NameContains != "" {
+		where = append(where, fmt.Sprintf(`LOWER(name) LIKE LOWER(%s) ESCAPE '\'`, arg("%"+escapeLike(q.NameContains)+"%")))
+	}
+
+	op := ">"
+	if q.Direction == SortDesc {
+		op = "<"
+	}
+
+	if c, err := decodeItemCursor(q.Cursor); q.Cursor != "" && err == nil {
+		switch q.Sort {
+		case ItemSortID:
+			where = append(where, fmt.Sprintf("id %s %s", op, arg(c.ID)))
+		case ItemSortCreatedAt:
+			t, _ := time.Parse(time.RFC3339Nano, c.Value)
+			where = append(where, fmt.Sprintf("(created_at, id) %s (%s, %s)", op, arg(timeArg(t)), arg(c.ID)))
+		default:
+			where = append(where, fmt.Sprintf("(%s, id) %s (%s, %s)", q.Sort, op, arg(c.Value), arg(c.ID)))
+		}
+	}
+
+	query := "SELECT " + itemColumns + " FROM items"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+
+	order := fmt.Sprintf("id %s", q.Direction)
+	if q.Sort != ItemSortID {
+		order = fmt.Sprintf("%s %s, %s", q.Sort, q.Direction, order)
+	}
+	query += fmt.Sprintf(" ORDER BY %s LIMIT %s", order, arg(q.Limit+1))
+
+	return query, args
+}
+
+func (q ListItemsQuery) nextCursor(last *Item) string {
+	c := itemCursor{Sort: q.Sort, Direction: q.Direction, ID: last.ID}
+	switch q.Sort {
+	case ItemSortName:
+		c.Value = last.Name
+	case ItemSortCreatedAt:
+		c.Value = last.CreatedAt.Format(time.RFC3339Nano)
+	}
+
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeItemCursor(s string) (*itemCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &itemCursor{}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
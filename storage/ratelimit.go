@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// RateLimitState is the state of a rate limited key after a request, using
+// the generic cell rate algorithm: TAT is the time at which the key would be
+// back to a full burst.
+type RateLimitState struct {
+	Allowed bool
+	TAT     time.Time
+	Now     time.Time
+}
+
+// TakeRateLimit counts a request against key in the database, so replicas
+// share the limit. A request is allowed when, after it, the key stays within
+// tolerance of the current time; each request costs interval. Denied requests
+// aren't counted. It needs Postgres.
+func (s *Storage) TakeRateLimit(ctx context.Context, key string, interval, tolerance time.Duration) (*RateLimitState, error) {
+	if s.dialect != DialectPostgres {
+		return nil, errors.New("shared rate limits require a postgres database")
+	}
+
+	st := &RateLimitState{Allowed: true}
+	row := s.conn.QueryRowContext(ctx, `
+		INSERT INTO rate_limits AS r (key, tat) VALUES ($1, now() + $2::double precision * interval '1 second')
+		ON CONFLICT (key) DO UPDATE SET tat = GREATEST(r.tat, now()) + $2::double precision * interval '1 second'
+		WHERE GREATEST(r.tat, now()) + $2::double precision * interval '1 second' <= now() + $3::double precision * interval '1 second'
+		RETURNING tat, now()`,
+		key, interval.Seconds(), tolerance.Seconds())
+	err := row.Scan(&st.TAT, &st.Now)
+	if errors.Is(err, sql.ErrNoRows) {
+		st.Allowed = false
+		err = s.conn.QueryRowContext(ctx, "SELECT tat, now() FROM rate_limits WHERE key = $1", key).Scan(&st.TAT, &st.Now)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not take rate limit: %w", err)
+	}
+
+	return st, nil
+}
+
+// PruneRateLimits deletes the keys that are back to a full burst, they are
+// the same as keys never seen.
+func (s *Storage) PruneRateLimits(ctx context.Context) error {
+	if _, err := s.conn.ExecContext(ctx, "DELETE FROM rate_limits WHERE tat < now()"); err != nil {
+		return fmt.Errorf("could not prune rate limits: %w", err)
+	}
+
+	return nil
+}
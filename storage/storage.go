@@ -1,27 +1,158 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"net/url"
+	"time"
 
+	"github.com/geisonsn/go-and-compose/logging"
 	_ "github.com/lib/pq"
 )
 
+// maxConnectBackoff caps the wait between two connection attempts.
+var maxConnectBackoff = time.Second * 10
+
 type Storage struct {
-	conn *sql.DB
+	conn    *sql.DB
+	dialect string
 }
 
 type Scanner interface {
 	Scan(dest ...interface{}) error
 }
 
-func NewStorage(databaseURL string) (*Storage, error) {
-	conn, err := sql.Open("postgres", databaseURL)
+// Options configures the connection pool and how NewStorage checks that the
+// database is reachable.
+type Options struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+
+	// ConnectTimeout bounds every connection attempt made by NewStorage.
+	ConnectTimeout time.Duration
+	// ConnectRetries is how many more attempts are made after the first one
+	// fails, waiting ConnectBackoff and then twice as long each time.
+	ConnectRetries int
+	ConnectBackoff time.Duration
+}
+
+func DefaultOptions() Options {
+	return Options{
+		MaxOpenConns:    25,
+		MaxIdleConns:    25,
+		ConnMaxLifetime: time.Minute * 30,
+		ConnMaxIdleTime: time.Minute * 5,
+		ConnectTimeout:  time.Second * 5,
+		ConnectRetries:  5,
+		ConnectBackoff:  time.Millisecond * 500,
+	}
+}
+
+// NewStorage opens a connection pool for databaseURL and waits until the
+// database answers, retrying with backoff, so misconfiguration fails fast.
+// The url's scheme selects the backend, see parseDatabaseURL.
+func NewStorage(ctx context.Context, databaseURL string, opts Options) (*Storage, error) {
+	driver, dataSource, dialect, err := parseDatabaseURL(databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid database url: %w", err)
+	}
+
+	conn, err := sql.Open(driver, dataSource)
 	if err != nil {
 		return nil, fmt.Errorf("could not open sql: %w", err)
 	}
 
+	conn.SetMaxOpenConns(opts.MaxOpenConns)
+	conn.SetMaxIdleConns(opts.MaxIdleConns)
+	conn.SetConnMaxLifetime(opts.ConnMaxLifetime)
+	conn.SetConnMaxIdleTime(opts.ConnMaxIdleTime)
+
+	if err := connect(ctx, conn, opts); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("could not connect to %s: %w", RedactURL(databaseURL), err)
+	}
+
 	return &Storage{
-		conn: conn,
+		conn:    conn,
+		dialect: dialect,
 	}, nil
 }
+
+func connect(ctx context.Context, conn *sql.DB, opts Options) error {
+	backoff := opts.ConnectBackoff
+	for attempt := 0; ; attempt++ {
+		pingCtx, cancel := context.WithTimeout(ctx, opts.ConnectTimeout)
+		err := conn.PingContext(pingCtx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+
+		if attempt >= opts.ConnectRetries {
+			return fmt.Errorf("database unreachable after %d attempts: %w", attempt+1, err)
+		}
+
+		logging.FromContext(ctx).WithError(err).WithField("retry_in", backoff).Warn("database unreachable, retrying")
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		if backoff *= 2; backoff > maxConnectBackoff {
+			backoff = maxConnectBackoff
+		}
+	}
+}
+
+// RedactURL hides the password of databaseURL so it can be logged.
+func RedactURL(databaseURL string) string {
+	u, err := url.Parse(databaseURL)
+	if err != nil || u.Scheme == "" {
+		return "database"
+	}
+
+	return u.Redacted()
+}
+
+// Ping checks that the database can be reached.
+func (s *Storage) Ping(ctx context.Context) error {
+	return s.conn.PingContext(ctx)
+}
+
+// Close closes the connection pool, waiting for in-flight queries to finish.
+func (s *Storage) Close() error {
+	return s.conn.Close()
+}
+
+// Stats returns the connection pool statistics.
+func (s *Storage) Stats() sql.DBStats {
+	return s.conn.Stats()
+}
+
+// NotFoundError is returned when the requested record does not exist.
+type NotFoundError struct {
+	Resource string
+	ID       string
+}
+
+func (e *NotFoundError) Error() string {
+	if e.ID == "" {
+		return fmt.Sprintf("%s not found", e.Resource)
+	}
+
+	return fmt.Sprintf("%s %s not found", e.Resource, e.ID)
+}
+
+// ConflictError is returned when a write would violate a uniqueness constraint.
+type ConflictError struct {
+	Resource   string
+	Constraint string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s conflicts with an existing record (%s)", e.Resource, e.Constraint)
+}
@@ -0,0 +1,96 @@
+// Package validation provides small, composable checks for request structs.
+package validation
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// FieldError describes why a single field is invalid.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+// Errors collects every failed check so they can be reported together.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, f := range e {
+		msgs = append(msgs, fmt.Sprintf("%s %s", f.Field, f.Message))
+	}
+
+	return "validation failed: " + strings.Join(msgs, ", ")
+}
+
+// Validator accumulates field errors. Only the first failure per field is
+// kept, so later rules can assume the earlier ones passed.
+type Validator struct {
+	errs   Errors
+	failed map[string]bool
+}
+
+func New() *Validator {
+	return &Validator{failed: map[string]bool{}}
+}
+
+func (v *Validator) fail(field, format string, args ...interface{}) {
+	if v.failed[field] {
+		return
+	}
+
+	v.failed[field] = true
+	v.errs = append(v.errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *Validator) Required(field, value string) *Validator {
+	if value == "" {
+		v.fail(field, "is required")
+	}
+
+	return v
+}
+
+func (v *Validator) MinLength(field, value string, min int) *Validator {
+	if utf8.RuneCountInString(value) < min {
+		v.fail(field, "must be at least %d characters", min)
+	}
+
+	return v
+}
+
+func (v *Validator) MaxLength(field, value string, max int) *Validator {
+	if utf8.RuneCountInString(value) > max {
+		v.fail(field, "must be at most %d characters", max)
+	}
+
+	return v
+}
+
+// Matches checks value against re, describing the expectation as allowed in
+// the error message.
+func (v *Validator) Matches(field, value string, re *regexp.Regexp, allowed string) *Validator {
+	if value != "" && !re.MatchString(value) {
+		v.fail(field, "may only contain %s", allowed)
+	}
+
+	return v
+}
+
+// Err returns the accumulated Errors, or nil when every check passed.
+func (v *Validator) Err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+
+	return v.errs
+}
+
+// Invalid records a failure for field that doesn't fit any of the other rules.
+func (v *Validator) Invalid(field, message string) *Validator {
+	v.fail(field, "%s", message)
+	return v
+}